@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	gamelogic "github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	persistence "github.com/bootdotdev/learn-pub-sub-starter/internal/persistence"
+)
+
+// Exit codes, besides 2 for invalid flags.
+const (
+	exitOK       = 0
+	exitFailure  = 1
+	exitDiverged = 3
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	logPath := flag.String("log", "events.jsonl", "the server's event log")
+	step := flag.Bool("step", false, "wait for Enter after each event: c continues without stopping, q quits")
+	username := flag.String("player", "", "also show the game as this player's client would have seen it")
+	until := flag.Uint64("until", 0, "stop after the event with this sequence number")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	f, err := os.Open(*logPath)
+	if err != nil {
+		logger.Error("could not open event log", "error", err)
+		return exitFailure
+	}
+	defer f.Close()
+
+	events := persistence.NewEventReader(f)
+	replay := gamelogic.NewReplay(logger)
+
+	// The player's view is fed the replayed deltas, just as their client
+	// is fed the server's.
+	var mirror *gamelogic.Mirror
+	if *username != "" {
+		gs := gamelogic.NewGameState(
+			*username,
+			gamelogic.WithLogger(logger),
+			gamelogic.WithPresenter(gamelogic.NewPresenter(os.Stdout)),
+		)
+		mirror = gamelogic.NewMirror(gs, func(context.Context) (gamelogic.WorldSnapshot, error) {
+			return replay.World().Snapshot(), nil
+		})
+	}
+
+	keys := bufio.NewScanner(os.Stdin)
+	code := exitOK
+	for {
+		e, err := events.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			logger.Error("could not read event log", "error", err)
+			code = exitFailure
+			break
+		}
+
+		printEvent(e)
+		deltas, err := replay.Step(e)
+		for _, d := range deltas {
+			printDelta(d)
+		}
+		if err != nil {
+			logger.Error("could not replay event", "error", err)
+			if errors.Is(err, gamelogic.ErrDiverged) {
+				fmt.Println("  recorded:")
+				for _, d := range e.Deltas {
+					printDelta(d)
+				}
+				code = exitDiverged
+			} else {
+				code = exitFailure
+			}
+			break
+		}
+
+		if mirror != nil {
+			switch e.Kind {
+			case gamelogic.EventStart, gamelogic.EventLoad:
+				mirror.HandleSnapshot(replay.World().Snapshot())
+			default:
+				for _, d := range deltas {
+					mirror.HandleDelta(context.Background(), d)
+				}
+			}
+		}
+
+		if *until != 0 && e.Seq >= *until {
+			break
+		}
+		if *step {
+			fmt.Print("> ")
+			if !keys.Scan() {
+				break
+			}
+			switch strings.TrimSpace(keys.Text()) {
+			case "c":
+				*step = false
+			case "q":
+				printWorld(replay.World())
+				return code
+			}
+		}
+	}
+
+	printWorld(replay.World())
+	return code
+}
+
+func printEvent(e gamelogic.Event) {
+	fmt.Printf("#%d %s %s", e.Seq, e.Time.Format("2006-01-02 15:04:05.000"), e.Kind)
+	switch e.Kind {
+	case gamelogic.EventStart, gamelogic.EventLoad:
+		fmt.Print(":")
+		if e.Map != nil {
+			fmt.Printf(" %s map,", e.Map.Name())
+		}
+		if e.Snapshot != nil {
+			fmt.Printf(" %d players, epoch %s at delta %d", len(e.Snapshot.Players), e.Snapshot.Epoch, e.Snapshot.Seq)
+		}
+	case gamelogic.EventSpawn:
+		if e.Spawn != nil {
+			fmt.Printf(": %s asks for a(n) %s in %s", e.Spawn.Username, e.Spawn.Rank, e.Spawn.Location)
+		}
+	case gamelogic.EventMove:
+		if e.Move != nil {
+			ids := []int{}
+			for _, unit := range e.Move.Units {
+				ids = append(ids, unit.ID)
+			}
+			fmt.Printf(": %s asks to move units %v to %s", e.Move.Player.Username, ids, e.Move.ToLocation)
+		}
+	case gamelogic.EventPause:
+		fmt.Printf(": paused=%t", e.Paused)
+	}
+	fmt.Println()
+}
+
+func printDelta(d gamelogic.WorldDelta) {
+	fmt.Printf("  delta %d %s", d.Seq, d.Kind)
+	switch d.Kind {
+	case gamelogic.DeltaSpawn, gamelogic.DeltaMove:
+		fmt.Printf(": %s", d.Username)
+		for _, unit := range d.Units {
+			fmt.Printf(" [%d %s in %s]", unit.ID, unit.Rank, unit.Location)
+		}
+		if len(d.Path) > 0 {
+			fmt.Printf(" via %v", d.Path)
+		}
+	case gamelogic.DeltaPause:
+		fmt.Printf(": paused=%t", d.Paused)
+	case gamelogic.DeltaWar:
+		war := d.War
+		fmt.Printf(" in %s: %s (power %d) attacked %s (power %d), %s",
+			war.Location, war.Attacker, war.AttackerPower, war.Defender, war.DefenderPower, war.Outcome)
+		usernames := []string{}
+		for username := range war.Killed {
+			usernames = append(usernames, username)
+		}
+		sort.Strings(usernames)
+		for _, username := range usernames {
+			fmt.Printf("; %s lost %v", username, war.Killed[username])
+		}
+	}
+	fmt.Println()
+}
+
+func printWorld(w *gamelogic.World) {
+	fmt.Printf("World at delta %d of epoch %s, paused=%t:\n", w.Seq(), w.Epoch(), w.Paused())
+	for _, p := range w.Players() {
+		ids := []int{}
+		for id := range p.Units {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		fmt.Printf("* %s has %d units.\n", p.Username, len(ids))
+		for _, id := range ids {
+			unit := p.Units[id]
+			fmt.Printf("  * %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
+		}
+	}
+}
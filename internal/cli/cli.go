@@ -0,0 +1,61 @@
+// Package cli holds the start-up and shutdown steps the Peril commands
+// share.
+package cli
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ExitFailure is the exit code of a command that could not start or run.
+const ExitFailure = 1
+
+// shutdownTimeout bounds each step of shutting down, so a broker that has
+// gone away can't keep a command from exiting.
+const shutdownTimeout = 5 * time.Second
+
+// DrainSubscriptions lets each subscription finish the messages it has
+// started on before it is closed.
+func DrainSubscriptions(logger *slog.Logger, subs ...*pubsub.Subscription) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, sub := range subs {
+		if err := sub.Drain(ctx); err != nil {
+			logger.Error("could not drain subscription", "queue", sub.QueueName(), "error", err)
+		}
+	}
+}
+
+// ServeMetrics exposes Prometheus metrics on addr in the background.
+func ServeMetrics(logger *slog.Logger, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		err := http.ListenAndServe(addr, mux)
+		if err != nil {
+			logger.Error("metrics server stopped", "error", err)
+		}
+	}()
+}
+
+// FlushTraces writes out the spans still buffered, through shutdown as
+// returned by tracing.Setup.
+func FlushTraces(logger *slog.Logger, shutdown func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		logger.Error("could not flush traces", "error", err)
+	}
+}
+
+// Fail logs err and returns ExitFailure, so a command's run function can
+// return it and still have its deferred cleanup happen.
+func Fail(err error, msg string) int {
+	slog.Error(msg, "error", err)
+	return ExitFailure
+}
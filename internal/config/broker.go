@@ -0,0 +1,168 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	AuthPlain    = "plain"
+	AuthExternal = "external"
+)
+
+func (b Broker) validate() error {
+	if b.TLS.Enabled && !strings.HasPrefix(b.URL, "amqps://") {
+		return errors.New("TLS needs an amqps:// broker URL")
+	}
+	switch b.Auth {
+	case AuthPlain:
+		if b.Password != "" && b.PasswordFile != "" {
+			return errors.New("set either a broker password or a password file, not both")
+		}
+	case AuthExternal:
+		if !b.TLS.Enabled || b.TLS.CertFile == "" {
+			return errors.New("external auth needs TLS with a client certificate")
+		}
+	default:
+		return fmt.Errorf("unknown broker auth %q", b.Auth)
+	}
+	return nil
+}
+
+// Dial connects to the configured broker, under the configured exchange
+// names. Both commands connect through it.
+func (cfg Config) Dial(logger *slog.Logger) (pubsub.Broker, error) {
+	amqpConfig, err := cfg.Broker.AMQPConfig()
+	if err != nil {
+		return nil, err
+	}
+	login, err := cfg.Broker.Login()
+	if err != nil {
+		return nil, err
+	}
+	broker, err := pubsub.DialAMQPConfig(
+		cfg.Broker.URL,
+		amqpConfig,
+		pubsub.WithBrokerLogger(logger),
+		pubsub.WithUserID(login),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pubsub.RenameExchanges(broker, cfg.Exchanges.Names()), nil
+}
+
+// AMQPConfig is how to connect to the broker, for pubsub.DialAMQPConfig.
+func (b Broker) AMQPConfig() (amqp.Config, error) {
+	config := amqp.Config{
+		Vhost:     b.VHost,
+		Heartbeat: 10 * time.Second,
+		Locale:    "en_US",
+	}
+
+	sasl, err := b.sasl()
+	if err != nil {
+		return amqp.Config{}, err
+	}
+	config.SASL = sasl
+
+	if b.TLS.Enabled {
+		config.TLSClientConfig, err = b.TLS.config()
+		if err != nil {
+			return amqp.Config{}, err
+		}
+	}
+	return config, nil
+}
+
+// Login is the user the broker knows the connection as: the client
+// certificate's common name with external auth, or else the configured or
+// URL username.
+func (b Broker) Login() (string, error) {
+	if b.Auth == AuthExternal {
+		cert, err := tls.LoadX509KeyPair(b.TLS.CertFile, b.TLS.KeyFile)
+		if err != nil {
+			return "", fmt.Errorf("could not load client certificate: %v", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return "", fmt.Errorf("could not parse client certificate: %v", err)
+		}
+		return leaf.Subject.CommonName, nil
+	}
+	if b.Username != "" {
+		return b.Username, nil
+	}
+	uri, err := amqp.ParseURI(b.URL)
+	if err != nil {
+		return "", err
+	}
+	return uri.Username, nil
+}
+
+// sasl returns the mechanisms to log in with, or nil to use the credentials
+// in the URL.
+func (b Broker) sasl() ([]amqp.Authentication, error) {
+	if b.Auth == AuthExternal {
+		return []amqp.Authentication{&amqp.ExternalAuth{}}, nil
+	}
+
+	password := b.Password
+	if b.PasswordFile != "" {
+		data, err := os.ReadFile(b.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read broker password file: %v", err)
+		}
+		password = strings.TrimRight(string(data), "\r\n")
+	}
+	if b.Username == "" && password == "" {
+		return nil, nil
+	}
+
+	uri, err := amqp.ParseURI(b.URL)
+	if err != nil {
+		return nil, err
+	}
+	auth := uri.PlainAuth()
+	if b.Username != "" {
+		auth.Username = b.Username
+	}
+	if password != "" {
+		auth.Password = password
+	}
+	return []amqp.Authentication{auth}, nil
+}
+
+func (t TLS) config() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: t.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA file: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", t.CAFile)
+		}
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
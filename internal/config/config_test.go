@@ -0,0 +1,166 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "peril.toml", `
+prefetch = 20
+
+[broker]
+vhost = "from-file"
+
+[game_log]
+delay = "3s"
+`)
+	tests := []struct {
+		name         string
+		file         bool
+		env          map[string]string
+		args         []string
+		wantPrefetch int
+		wantVHost    string
+		wantDelay    time.Duration
+	}{
+		{
+			name:         "defaults",
+			wantPrefetch: 10,
+			wantDelay:    time.Second,
+		},
+		{
+			name:         "file over defaults",
+			file:         true,
+			wantPrefetch: 20,
+			wantVHost:    "from-file",
+			wantDelay:    3 * time.Second,
+		},
+		{
+			name:         "env over file",
+			file:         true,
+			env:          map[string]string{"PERIL_PREFETCH": "30", "PERIL_BROKER_VHOST": "from-env"},
+			wantPrefetch: 30,
+			wantVHost:    "from-env",
+			wantDelay:    3 * time.Second,
+		},
+		{
+			name:         "flags over env",
+			file:         true,
+			env:          map[string]string{"PERIL_PREFETCH": "30", "PERIL_BROKER_VHOST": "from-env"},
+			args:         []string{"-prefetch", "40", "-game-log-delay", "4s"},
+			wantPrefetch: 40,
+			wantVHost:    "from-env",
+			wantDelay:    4 * time.Second,
+		},
+		{
+			name:         "a flag set to the default still wins",
+			file:         true,
+			env:          map[string]string{"PERIL_PREFETCH": "30"},
+			args:         []string{"-prefetch", "10"},
+			wantPrefetch: 10,
+			wantVHost:    "from-file",
+			wantDelay:    3 * time.Second,
+		},
+		{
+			name:         "env without a file",
+			env:          map[string]string{"PERIL_GAME_LOG_DELAY": "5s"},
+			wantPrefetch: 10,
+			wantDelay:    5 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvConfigFile, "")
+			if tt.file {
+				t.Setenv(EnvConfigFile, file)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Prefetch != tt.wantPrefetch {
+				t.Errorf("prefetch = %d, want %d", cfg.Prefetch, tt.wantPrefetch)
+			}
+			if cfg.Broker.VHost != tt.wantVHost {
+				t.Errorf("vhost = %q, want %q", cfg.Broker.VHost, tt.wantVHost)
+			}
+			if cfg.GameLog.Delay != tt.wantDelay {
+				t.Errorf("game log delay = %v, want %v", cfg.GameLog.Delay, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFlagOverEnvFile(t *testing.T) {
+	t.Setenv(EnvConfigFile, writeFile(t, "env.yaml", "prefetch: 20\n"))
+	flagFile := writeFile(t, "flag.yaml", "prefetch: 30\n")
+	cfg, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", flagFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Prefetch != 30 {
+		t.Errorf("prefetch = %d, want 30 from the -config file", cfg.Prefetch)
+	}
+}
+
+func TestLoadUnitPower(t *testing.T) {
+	t.Setenv(EnvConfigFile, writeFile(t, "rules.yaml", "rules:\n  unit_power:\n    artillery: 8\n"))
+	t.Setenv("PERIL_UNIT_POWER", "cavalry=6")
+	cfg, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-unit-power", "infantry=2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"infantry": 2, "cavalry": 6, "artillery": 8}
+	for rank, power := range want {
+		if got := cfg.Rules.UnitPower[gamelogic.UnitRank(rank)]; got != power {
+			t.Errorf("%s power = %d, want %d", rank, got, power)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		args    []string
+		wantErr string
+	}{
+		{name: "unknown toml setting", file: "bad.toml", content: "prefetchh = 2\n", wantErr: "unknown setting"},
+		{name: "unknown yaml setting", file: "bad.yaml", content: "prefetchh: 2\n", wantErr: "not found"},
+		{name: "unknown extension", file: "bad.ini", content: "", wantErr: "must be .toml"},
+		{name: "invalid prefetch", args: []string{"-prefetch", "0"}, wantErr: "prefetch"},
+		{name: "negative move range", args: []string{"-move-range", "-1"}, wantErr: "move range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvConfigFile, "")
+			if tt.file != "" {
+				t.Setenv(EnvConfigFile, writeFile(t, tt.file, tt.content))
+			}
+			_, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
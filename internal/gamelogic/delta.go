@@ -0,0 +1,122 @@
+package gamelogic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+)
+
+// HandleDelta shows the player a change the server made to the World, and
+// keeps their own units in step with it.
+func (gs *GameState) HandleDelta(d WorldDelta) pubsub.AckType {
+	username := gs.GetUsername()
+	switch d.Kind {
+	case DeltaSpawn:
+		if d.Username != username {
+			return pubsub.Ack
+		}
+		for _, unit := range d.Units {
+			gs.addUnit(unit)
+			gs.presenter.Printf("Spawned a(n) %s in %s with id %v\n", unit.Rank, unit.Location, unit.ID)
+		}
+		gs.answer(nil)
+	case DeltaMove:
+		if d.Username == username {
+			for _, unit := range d.Units {
+				gs.UpdateUnit(unit)
+			}
+			gs.presenter.Printf("Moved %v units to %s\n", len(d.Units), d.Location)
+			if len(d.Path) > 2 {
+				gs.presenter.Printf("They marched through %s\n", joinLocations(d.Path[1:len(d.Path)-1]))
+			}
+			gs.answer(nil)
+			return pubsub.Ack
+		}
+		defer gs.presenter.Println("------------------------")
+		gs.presenter.Println()
+		gs.presenter.Println("==== Move Detected ====")
+		gs.presenter.Printf("%s is moving %v unit(s) to %s\n", d.Username, len(d.Units), d.Location)
+		for _, unit := range d.Units {
+			gs.presenter.Printf("* %v\n", unit.Rank)
+		}
+	case DeltaWar:
+		gs.handleWar(*d.War)
+	case DeltaRejected:
+		if d.Username == username {
+			gs.answer(fmt.Errorf("the server refused your order: %s", d.Reason))
+		}
+	}
+	return pubsub.Ack
+}
+
+// handleCoveredDelta is for deltas a snapshot caught the player up with
+// instead: their units are already in step, but an order of theirs still
+// needs answering.
+func (gs *GameState) handleCoveredDelta(d WorldDelta) {
+	if d.Username != gs.GetUsername() {
+		return
+	}
+	switch d.Kind {
+	case DeltaSpawn, DeltaMove:
+		gs.answer(nil)
+	}
+}
+
+func (gs *GameState) handleWar(war War) {
+	username := gs.GetUsername()
+	if war.Attacker != username && war.Defender != username {
+		return
+	}
+	defer gs.presenter.Println("------------------------")
+	gs.presenter.Println()
+	gs.presenter.Println("==== War Declared ====")
+	gs.presenter.Printf("%s has declared war on %s in %s!\n", war.Attacker, war.Defender, war.Location)
+	gs.presenter.Printf("Attacker has a power level of %v\n", war.AttackerPower)
+	gs.presenter.Printf("Defender has a power level of %v\n", war.DefenderPower)
+	switch war.Outcome {
+	case WarOutcomeDraw:
+		gs.presenter.Println("The war ended in a draw!")
+	default:
+		gs.presenter.Printf("%s has won the war!\n", war.Winner())
+	}
+	killed := war.Killed[username]
+	if len(killed) == 0 {
+		return
+	}
+	if war.Loser() == username {
+		gs.presenter.Println("You have lost the war!")
+	}
+	for _, id := range killed {
+		gs.removeUnit(id)
+	}
+	gs.presenter.Printf("Your units in %s have been killed.\n", war.Location)
+}
+
+// ExpectAnswer forgets any earlier answer from the server, before sending it
+// a new order.
+func (gs *GameState) ExpectAnswer() {
+	select {
+	case <-gs.answers:
+	default:
+	}
+}
+
+// AwaitAnswer waits for the server to apply or refuse the order sent since
+// ExpectAnswer, so the next command sees its result.
+func (gs *GameState) AwaitAnswer(ctx context.Context) error {
+	select {
+	case err := <-gs.answers:
+		return err
+	case <-ctx.Done():
+		return errors.New("the server did not answer your order")
+	}
+}
+
+func (gs *GameState) answer(err error) {
+	select {
+	case gs.answers <- err:
+	default:
+	}
+}
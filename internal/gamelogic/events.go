@@ -0,0 +1,121 @@
+package gamelogic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+type EventKind string
+
+const (
+	// EventStart is recorded when the server starts, with its rules, its
+	// map and the world it starts from.
+	EventStart EventKind = "start"
+	EventSpawn EventKind = "spawn"
+	EventMove  EventKind = "move"
+	EventPause EventKind = "pause"
+	// EventLoad is recorded when a save is loaded, with the loaded world.
+	EventLoad EventKind = "load"
+)
+
+// Event is one change to the World, as recorded in the server's event log:
+// what was asked for, and the deltas it caused, wars included.
+type Event struct {
+	// Seq numbers the events in a log, from 1 and without gaps.
+	Seq      uint64
+	Time     time.Time
+	Kind     EventKind
+	Rules    *Rules         `json:",omitempty"`
+	Map      *Map           `json:",omitempty"`
+	Snapshot *WorldSnapshot `json:",omitempty"`
+	Spawn    *ArmySpawn     `json:",omitempty"`
+	Move     *ArmyMove      `json:",omitempty"`
+	Paused   bool           `json:",omitempty"`
+	Deltas   []WorldDelta   `json:",omitempty"`
+}
+
+// ErrDiverged means replaying an event didn't give the deltas recorded for
+// it.
+var ErrDiverged = errors.New("replay diverged from the recorded deltas")
+
+// Replay rebuilds a World by folding events through the same World methods
+// the server ran them with.
+type Replay struct {
+	world  *World
+	logger *slog.Logger
+}
+
+func NewReplay(logger *slog.Logger) *Replay {
+	return &Replay{
+		world:  NewWorld(DefaultRules(), ClassicMap(), logger),
+		logger: logger,
+	}
+}
+
+// World is the world as of the last event replayed.
+func (r *Replay) World() *World {
+	return r.world
+}
+
+// Step replays one event and returns the deltas it caused. The error wraps
+// ErrDiverged if they differ from the recorded ones, though the world still
+// moves on with the replayed deltas.
+func (r *Replay) Step(e Event) ([]WorldDelta, error) {
+	var deltas []WorldDelta
+	var err error
+	switch e.Kind {
+	case EventStart:
+		rules := DefaultRules()
+		if e.Rules != nil {
+			rules = *e.Rules
+		}
+		worldMap := e.Map
+		if worldMap == nil {
+			var err error
+			worldMap, err = OpenMap(rules.Map)
+			if err != nil {
+				return nil, fmt.Errorf("event %d: %w", e.Seq, err)
+			}
+		}
+		r.world = NewWorld(rules, worldMap, r.logger)
+		if e.Snapshot != nil {
+			r.world.Restore(*e.Snapshot)
+		}
+	case EventLoad:
+		if e.Snapshot == nil {
+			return nil, fmt.Errorf("event %d: load has no snapshot", e.Seq)
+		}
+		r.world.Restore(*e.Snapshot)
+	case EventSpawn:
+		if e.Spawn == nil {
+			return nil, fmt.Errorf("event %d: spawn has no order", e.Seq)
+		}
+		deltas, err = r.world.Spawn(*e.Spawn)
+	case EventMove:
+		if e.Move == nil {
+			return nil, fmt.Errorf("event %d: move has no order", e.Seq)
+		}
+		deltas, err = r.world.Move(*e.Move)
+	case EventPause:
+		deltas = []WorldDelta{r.world.SetPaused(e.Paused)}
+	default:
+		return nil, fmt.Errorf("event %d: unknown kind %q", e.Seq, e.Kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("event %d: %w: %v", e.Seq, ErrDiverged, err)
+	}
+
+	if len(deltas) == 0 && len(e.Deltas) == 0 {
+		return deltas, nil
+	}
+	got, _ := json.Marshal(deltas)
+	want, _ := json.Marshal(e.Deltas)
+	if !bytes.Equal(got, want) {
+		return deltas, fmt.Errorf("event %d: %w", e.Seq, ErrDiverged)
+	}
+	return deltas, nil
+}
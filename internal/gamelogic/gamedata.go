@@ -19,15 +19,79 @@ type Unit struct {
 	Location Location
 }
 
+// ArmySpawn asks the server to spawn a unit for Username. The server picks
+// the unit's ID.
+type ArmySpawn struct {
+	Username string
+	Location Location
+	Rank     UnitRank
+}
+
+// ArmyMove asks the server to move units. The server only trusts
+// Player.Username and the unit IDs: where the units are and what they are
+// comes from its own World.
 type ArmyMove struct {
 	Player     Player
 	Units      []Unit
 	ToLocation Location
 }
 
-type RecognitionOfWar struct {
-	Attacker Player
-	Defender Player
+type DeltaKind string
+
+const (
+	DeltaSpawn DeltaKind = "spawn"
+	DeltaMove  DeltaKind = "move"
+	DeltaWar   DeltaKind = "war"
+	DeltaPause DeltaKind = "pause"
+	// DeltaRejected tells Username that a spawn or move was refused. It
+	// changes nothing.
+	DeltaRejected DeltaKind = "rejected"
+)
+
+// WorldDelta is one change to the World, published by the server.
+type WorldDelta struct {
+	// Seq numbers the deltas that change the World, from 1 and without
+	// gaps, within an Epoch. Rejections have neither.
+	Seq      uint64 `json:",omitempty"`
+	Epoch    string `json:",omitempty"`
+	Kind     DeltaKind
+	Username string
+	// Units are the spawned unit, or the moved units at their new location.
+	Units    []Unit   `json:",omitempty"`
+	Location Location `json:",omitempty"`
+	// Path is every territory moved units passed through, from where they
+	// were to Location.
+	Path   []Location `json:",omitempty"`
+	War    *War       `json:",omitempty"`
+	Paused bool       `json:",omitempty"`
+	Reason string     `json:",omitempty"`
+}
+
+// WorldSnapshot is the whole World as of the delta numbered Seq.
+type WorldSnapshot struct {
+	Seq uint64
+	// Epoch changes whenever the World is loaded, which starts its deltas
+	// over from the saved Seq.
+	Epoch       string
+	Paused      bool
+	Players     []Player
+	NextUnitIDs map[string]int
+}
+
+// WorldSnapshotRequest asks the server for its latest WorldSnapshot.
+type WorldSnapshotRequest struct{}
+
+// War is fought when units move or spawn into a location held by another
+// player.
+type War struct {
+	Location      Location
+	Attacker      string
+	Defender      string
+	AttackerPower int
+	DefenderPower int
+	Outcome       WarOutcome
+	// Killed lists the IDs of the units each player lost.
+	Killed map[string][]int
 }
 
 type Location string
@@ -39,14 +103,3 @@ func getAllRanks() map[UnitRank]struct{} {
 		RankArtillery: {},
 	}
 }
-
-func getAllLocations() map[Location]struct{} {
-	return map[Location]struct{}{
-		"americas":   {},
-		"europe":     {},
-		"africa":     {},
-		"asia":       {},
-		"australia":  {},
-		"antarctica": {},
-	}
-}
@@ -1,29 +1,30 @@
 package gamelogic
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
-	"os"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
-	"github.com/rabbitmq/amqp091-go"
 )
 
 func PrintClientHelp() {
 	fmt.Println("Possible commands:")
 	fmt.Println("* move <location> <unitID> <unitID> <unitID>...")
 	fmt.Println("    example:")
-	fmt.Println("    move asia 1")
+	fmt.Println("    move ukraine 1")
 	fmt.Println("* spawn <location> <rank>")
 	fmt.Println("    example:")
-	fmt.Println("    spawn europe infantry")
+	fmt.Println("    spawn scandinavia infantry")
 	fmt.Println("* status")
+	fmt.Println("* world")
+	fmt.Println("* map [<location> [<location>]]")
+	fmt.Println("    example:")
+	fmt.Println("    map ukraine")
 	fmt.Println("* spam <n>")
 	fmt.Println("    example:")
 	fmt.Println("    spam 5")
@@ -31,14 +32,18 @@ func PrintClientHelp() {
 	fmt.Println("* help")
 }
 
-func ClientWelcome() (string, error) {
+// ClientWelcome greets the player, asking for a username unless one is
+// given.
+func ClientWelcome(in *Input, username string) (string, error) {
 	fmt.Println("Welcome to the Peril client!")
-	fmt.Println("Please enter your username:")
-	words := GetInput()
-	if len(words) == 0 {
-		return "", errors.New("you must enter a username. goodbye")
+	if username == "" {
+		fmt.Println("Please enter your username:")
+		words, err := in.Next()
+		if err != nil {
+			return "", errors.New("you must enter a username. goodbye")
+		}
+		username = words[0]
 	}
-	username := words[0]
 	fmt.Printf("Welcome, %s!\n", username)
 	PrintClientHelp()
 	return username, nil
@@ -48,22 +53,13 @@ func PrintServerHelp() {
 	fmt.Println("Possible commands:")
 	fmt.Println("* pause")
 	fmt.Println("* resume")
+	fmt.Println("* save <name>")
+	fmt.Println("* load <name>")
+	fmt.Println("* saves")
 	fmt.Println("* quit")
 	fmt.Println("* help")
 }
 
-func GetInput() []string {
-	fmt.Print("> ")
-	scanner := bufio.NewScanner(os.Stdin)
-	scanned := scanner.Scan()
-	if !scanned {
-		return nil
-	}
-	line := scanner.Text()
-	line = strings.TrimSpace(line)
-	return strings.Fields(line)
-}
-
 func GetMaliciousLog() string {
 	possibleLogs := []string{
 		"Never interrupt your enemy when he is making a mistake.",
@@ -84,42 +80,48 @@ func PrintQuit() {
 
 func (gs *GameState) CommandStatus() {
 	if gs.isPaused() {
-		fmt.Println("The game is paused.")
+		gs.presenter.Println("The game is paused.")
 		return
 	} else {
-		fmt.Println("The game is not paused.")
+		gs.presenter.Println("The game is not paused.")
 	}
 
 	p := gs.GetPlayerSnap()
-	fmt.Printf("You are %s, and you have %d units.\n", p.Username, len(p.Units))
+	gs.presenter.Printf("You are %s, and you have %d units.\n", p.Username, len(p.Units))
 	for _, unit := range p.Units {
-		fmt.Printf("* %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
+		gs.presenter.Printf("* %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
 	}
 }
 
-func (gs *GameState) CommandSpam(input []string, channel *amqp091.Channel) {
+func (gs *GameState) CommandSpam(input []string, publisher pubsub.Publisher) {
 	if len(input) < 2 {
-		fmt.Println("spam <n>")
+		gs.presenter.Println("spam <n>")
 		return
 	}
 
 	count, err := strconv.Atoi(input[1])
 	if err != nil {
-		fmt.Println("Invalid number provided")
+		gs.presenter.Println("Invalid number provided")
 		return
 	}
 
+	ctx := pubsub.ContextWithSender(context.Background(), gs.GetUsername())
+	ctx = pubsub.ContextWithLogger(ctx, gs.logger)
 	for i := 0; i < count; i++ {
 		maliciousLog := GetMaliciousLog()
-		pubsub.PublishGob(
-			channel,
-			routing.ExchangePerilTopic,
-			routing.GameLogSlug+"."+gs.GetPlayerSnap().Username,
+		err := routing.Publish(
+			ctx,
+			publisher,
+			routing.GameLogRoute,
+			routing.Params{"username": gs.GetPlayerSnap().Username},
 			routing.GameLog{
 				CurrentTime: time.Now(),
 				Message:     maliciousLog,
 				Username:    gs.GetPlayerSnap().Username,
 			},
 		)
+		if err != nil {
+			gs.logger.Error("could not publish spam", "error", err)
+		}
 	}
 }
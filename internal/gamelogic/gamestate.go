@@ -1,6 +1,8 @@
 package gamelogic
 
 import (
+	"log/slog"
+	"os"
 	"sync"
 )
 
@@ -8,17 +10,57 @@ type GameState struct {
 	Player Player
 	Paused bool
 	mu     *sync.RWMutex
+
+	rules     Rules
+	worldMap  *Map
+	logger    *slog.Logger
+	presenter *Presenter
+	// answers receives the server's answer to the player's last order.
+	answers chan error
+}
+
+type GameStateOption func(*GameState)
+
+// WithLogger sends the game's diagnostics to logger instead of
+// slog.Default().
+func WithLogger(logger *slog.Logger) GameStateOption {
+	return func(gs *GameState) {
+		gs.logger = logger
+	}
+}
+
+// WithMap plays the game on m instead of ClassicMap.
+func WithMap(m *Map) GameStateOption {
+	return func(gs *GameState) {
+		gs.worldMap = m
+	}
+}
+
+// WithPresenter shows player-facing output through p instead of on stdout.
+func WithPresenter(p *Presenter) GameStateOption {
+	return func(gs *GameState) {
+		gs.presenter = p
+	}
 }
 
-func NewGameState(username string) *GameState {
-	return &GameState{
+func NewGameState(username string, opts ...GameStateOption) *GameState {
+	gs := &GameState{
 		Player: Player{
 			Username: username,
 			Units:    map[int]Unit{},
 		},
-		Paused: false,
-		mu:     &sync.RWMutex{},
+		Paused:    false,
+		mu:        &sync.RWMutex{},
+		rules:     DefaultRules(),
+		worldMap:  ClassicMap(),
+		logger:    slog.Default(),
+		presenter: NewPresenter(os.Stdout),
+		answers:   make(chan error, 1),
+	}
+	for _, opt := range opts {
+		opt(gs)
 	}
+	return gs
 }
 
 func (gs *GameState) resumeGame() {
@@ -45,16 +87,28 @@ func (gs *GameState) addUnit(u Unit) {
 	gs.Player.Units[u.ID] = u
 }
 
-func (gs *GameState) removeUnitsInLocation(loc Location) {
+// restore takes the player's units and the pause state from a snapshot.
+func (gs *GameState) restore(s WorldSnapshot) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
-	for k, v := range gs.Player.Units {
-		if v.Location == loc {
-			delete(gs.Player.Units, k)
+	gs.Paused = s.Paused
+	gs.Player.Units = map[int]Unit{}
+	for _, player := range s.Players {
+		if player.Username != gs.Player.Username {
+			continue
+		}
+		for id, unit := range player.Units {
+			gs.Player.Units[id] = unit
 		}
 	}
 }
 
+func (gs *GameState) removeUnit(id int) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	delete(gs.Player.Units, id)
+}
+
 func (gs *GameState) UpdateUnit(u Unit) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
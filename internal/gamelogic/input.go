@@ -0,0 +1,111 @@
+package gamelogic
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Input reads commands one line at a time, from a terminal or a script.
+// Blank lines and lines starting with # are skipped.
+type Input struct {
+	scanner *bufio.Scanner
+	prompt  string
+	closer  io.Closer
+	done    chan struct{}
+	err     error
+}
+
+// NewInput reads commands from r, printing prompt before each one.
+func NewInput(r io.Reader, prompt string) *Input {
+	return &Input{
+		scanner: bufio.NewScanner(r),
+		prompt:  prompt,
+	}
+}
+
+// OpenInput reads commands from the terminal if path is empty, or from a
+// script: the file at path, or stdin if path is "-". Scripts get no prompt.
+// Open stdin only once: a second scanner on it would lose whatever the first
+// one had buffered.
+func OpenInput(path string) (*Input, error) {
+	switch path {
+	case "":
+		return NewInput(os.Stdin, "> "), nil
+	case "-":
+		return NewInput(os.Stdin, ""), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	in := NewInput(f, "")
+	in.closer = f
+	return in, nil
+}
+
+// Prompt is printed before each command, and is empty for scripts.
+func (in *Input) Prompt() string {
+	return in.prompt
+}
+
+// Next returns the words of the next command, or io.EOF once there are none
+// left.
+func (in *Input) Next() ([]string, error) {
+	for {
+		fmt.Print(in.prompt)
+		if !in.scanner.Scan() {
+			if err := in.scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		line := strings.TrimSpace(in.scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return strings.Fields(line), nil
+	}
+}
+
+func (in *Input) Close() error {
+	if in.closer == nil {
+		return nil
+	}
+	return in.closer.Close()
+}
+
+// Commands reads commands in the background, so a command loop can wait on
+// other things too. The next command is only read, and its prompt printed,
+// once Done is called for the previous one. The channel is closed at the end
+// of the input, after which Err reports whether reading it failed.
+func (in *Input) Commands() <-chan []string {
+	commands := make(chan []string)
+	in.done = make(chan struct{})
+	go func() {
+		defer close(commands)
+		for {
+			words, err := in.Next()
+			if err != nil {
+				if err != io.EOF {
+					in.err = err
+				}
+				return
+			}
+			commands <- words
+			<-in.done
+		}
+	}()
+	return commands
+}
+
+// Done reports that the last command from Commands has been handled.
+func (in *Input) Done() {
+	in.done <- struct{}{}
+}
+
+func (in *Input) Err() error {
+	return in.err
+}
@@ -2,22 +2,23 @@ package gamelogic
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"time"
 
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
-const logsFile = "game.log"
-
-const writeToDiskSleep = 1 * time.Second
+// LogWriter appends game logs to a file.
+type LogWriter struct {
+	Path string
+	// Delay is slept before every write, to simulate a slow disk.
+	Delay time.Duration
+}
 
-func WriteLog(gamelog routing.GameLog) error {
-	log.Printf("received game log...")
-	time.Sleep(writeToDiskSleep)
+func (w LogWriter) Write(gamelog routing.GameLog) error {
+	time.Sleep(w.Delay)
 
-	f, err := os.OpenFile(logsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	f, err := os.OpenFile(w.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return fmt.Errorf("could not open logs file: %v", err)
 	}
@@ -0,0 +1,36 @@
+package gamelogic
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	spawnsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "peril",
+		Subsystem: "game",
+		Name:      "spawns_total",
+		Help:      "Units spawned, by rank.",
+	}, []string{"rank"})
+
+	movesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "peril",
+		Subsystem: "game",
+		Name:      "moves_total",
+		Help:      "Army moves handled, by outcome.",
+	}, []string{"outcome"})
+
+	warsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "peril",
+		Subsystem: "game",
+		Name:      "wars_total",
+		Help:      "Wars handled, by outcome.",
+	}, []string{"outcome"})
+
+	deltaGapsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "peril",
+		Subsystem: "game",
+		Name:      "delta_gaps_total",
+		Help:      "Gaps found in the sequence of world deltas.",
+	})
+)
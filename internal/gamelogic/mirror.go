@@ -0,0 +1,180 @@
+package gamelogic
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+)
+
+// maxPendingDeltas bounds the deltas a Mirror holds while it waits for a
+// snapshot. Past it they are dropped, and the next snapshot catches up.
+const maxPendingDeltas = 1000
+
+// SnapshotFetcher gets the server's latest WorldSnapshot.
+type SnapshotFetcher func(context.Context) (WorldSnapshot, error)
+
+// Mirror keeps a client's copy of the server's World. It starts from a
+// snapshot, then applies deltas strictly in sequence: older deltas are
+// ignored, and deltas after a gap are held back while it fetches a new
+// snapshot. Every client folding the same sequence sees the same World.
+//
+// The player's own GameState is kept in step as deltas are applied.
+type Mirror struct {
+	mu      sync.Mutex
+	gs      *GameState
+	world   *World
+	fetch   SnapshotFetcher
+	synced  bool
+	pending map[uint64]WorldDelta
+}
+
+func NewMirror(gs *GameState, fetch SnapshotFetcher) *Mirror {
+	return &Mirror{
+		gs:      gs,
+		world:   NewWorld(gs.rules, gs.worldMap, gs.logger),
+		fetch:   fetch,
+		pending: map[uint64]WorldDelta{},
+	}
+}
+
+// Sync fetches the latest snapshot and starts over from it. Deltas received
+// before it are applied on top, if they are newer.
+func (m *Mirror) Sync(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sync(ctx)
+}
+
+func (m *Mirror) sync(ctx context.Context) error {
+	s, err := m.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	m.restore(s)
+	return nil
+}
+
+// HandleSnapshot catches up with a snapshot the server broadcast, unless the
+// mirror is already past it.
+func (m *Mirror) HandleSnapshot(s WorldSnapshot) pubsub.AckType {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.synced && s.Epoch == m.world.Epoch() && s.Seq <= m.world.Seq() {
+		return pubsub.Ack
+	}
+	m.restore(s)
+	return pubsub.Ack
+}
+
+func (m *Mirror) restore(s WorldSnapshot) {
+	m.world.Restore(s)
+	m.synced = true
+	m.gs.restore(s)
+	m.gs.logger.Debug("synced world", "seq", s.Seq, "players", len(s.Players))
+	m.drain()
+}
+
+// HandleDelta applies d, and any held-back deltas it makes contiguous. On a
+// gap it fetches a new snapshot with ctx.
+func (m *Mirror) HandleDelta(ctx context.Context, d WorldDelta) pubsub.AckType {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if d.Seq == 0 {
+		m.gs.HandleDelta(d)
+		return pubsub.Ack
+	}
+	current := d.Epoch == m.world.Epoch()
+	if m.synced && current && d.Seq <= m.world.Seq() {
+		m.gs.handleCoveredDelta(d)
+		return pubsub.Ack
+	}
+	m.hold(d)
+	if !m.synced {
+		return pubsub.Ack
+	}
+	if !current || d.Seq > m.world.Seq()+1 {
+		deltaGapsTotal.Inc()
+		m.gs.logger.Warn("gap in world deltas", "have", m.world.Seq(), "got", d.Seq)
+		err := m.sync(ctx)
+		if err != nil {
+			m.gs.logger.Error("could not fetch world snapshot", "error", err)
+		}
+		return pubsub.Ack
+	}
+	m.drain()
+	return pubsub.Ack
+}
+
+func (m *Mirror) hold(d WorldDelta) {
+	if len(m.pending) >= maxPendingDeltas {
+		m.gs.logger.Warn("dropping held-back world deltas", "count", len(m.pending))
+		for _, pending := range m.pending {
+			m.gs.handleCoveredDelta(pending)
+		}
+		m.pending = map[uint64]WorldDelta{}
+	}
+	m.pending[d.Seq] = d
+}
+
+// drain applies held-back deltas for as long as they follow on, and forgets
+// those that are too old or from another epoch. The snapshot restored since
+// already holds their changes.
+func (m *Mirror) drain() {
+	for seq, d := range m.pending {
+		if seq <= m.world.Seq() || d.Epoch != m.world.Epoch() {
+			delete(m.pending, seq)
+			m.gs.handleCoveredDelta(d)
+		}
+	}
+	for {
+		d, ok := m.pending[m.world.Seq()+1]
+		if !ok {
+			return
+		}
+		delete(m.pending, d.Seq)
+		m.world.Apply(d)
+		m.gs.HandleDelta(d)
+	}
+}
+
+// Players returns every player's army as the mirror sees it.
+func (m *Mirror) Players() []Player {
+	return m.world.Players()
+}
+
+// Seq is the sequence number of the last delta the mirror applied, and
+// whether it has synced at all.
+func (m *Mirror) Seq() (uint64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.world.Seq(), m.synced
+}
+
+// CommandWorld shows every player's army, as the mirror sees it.
+func (gs *GameState) CommandWorld(m *Mirror) {
+	players := m.Players()
+	if len(players) == 0 {
+		gs.presenter.Println("Nobody has any units yet.")
+		return
+	}
+	for _, p := range players {
+		counts := map[Location]int{}
+		for _, unit := range p.Units {
+			counts[unit.Location]++
+		}
+		locations := []Location{}
+		for location := range counts {
+			locations = append(locations, location)
+		}
+		sort.Slice(locations, func(i, j int) bool {
+			return locations[i] < locations[j]
+		})
+		gs.presenter.Printf("%s has %d units.\n", p.Username, len(p.Units))
+		for _, location := range locations {
+			gs.presenter.Printf("* %s: %d\n", location, counts[location])
+		}
+	}
+}
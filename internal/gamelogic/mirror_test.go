@@ -0,0 +1,240 @@
+package gamelogic
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testServer plays a fixed game on a World, keeping the deltas it published
+// and the snapshot after each, so a Mirror can be fed them in any order.
+type testServer struct {
+	deltas    []WorldDelta
+	snapshots []WorldSnapshot
+}
+
+func newTestServer(t *testing.T, spawns ...ArmySpawn) *testServer {
+	t.Helper()
+	world := NewWorld(DefaultRules(), ClassicMap(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	s := &testServer{snapshots: []WorldSnapshot{world.Snapshot()}}
+	for _, spawn := range spawns {
+		deltas, err := world.Spawn(spawn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range deltas {
+			s.deltas = append(s.deltas, d)
+			s.snapshots = append(s.snapshots, world.Snapshot())
+		}
+	}
+	return s
+}
+
+// delta is the delta with sequence number seq.
+func (s *testServer) delta(seq uint64) WorldDelta {
+	return s.deltas[seq-1]
+}
+
+// fetcher hands out the snapshots after the given sequence numbers, one per
+// fetch, repeating the last. It counts the fetches.
+func (s *testServer) fetcher(seqs []uint64, fetches *int) SnapshotFetcher {
+	return func(context.Context) (WorldSnapshot, error) {
+		seq := seqs[len(seqs)-1]
+		if *fetches < len(seqs) {
+			seq = seqs[*fetches]
+		}
+		*fetches++
+		return s.snapshots[seq], nil
+	}
+}
+
+func newTestGameState(username string) *GameState {
+	return NewGameState(
+		username,
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithPresenter(NewPresenter(io.Discard)),
+	)
+}
+
+var testSpawns = []ArmySpawn{
+	{Username: "alice", Location: "ukraine", Rank: RankInfantry},
+	{Username: "bob", Location: "ural", Rank: RankCavalry},
+	{Username: "alice", Location: "scandinavia", Rank: RankArtillery},
+	{Username: "bob", Location: "alaska", Rank: RankInfantry},
+}
+
+func TestMirrorSequencing(t *testing.T) {
+	tests := []struct {
+		name string
+		// steps are the deltas delivered, by sequence number. 0 is a Sync.
+		steps []uint64
+		// snapshots are the sequence numbers of the snapshots fetched.
+		snapshots   []uint64
+		wantSeq     uint64
+		wantFetches int
+	}{
+		{
+			name:        "in order",
+			steps:       []uint64{0, 1, 2, 3, 4},
+			snapshots:   []uint64{0},
+			wantSeq:     4,
+			wantFetches: 1,
+		},
+		{
+			name:        "old and duplicate deltas are ignored",
+			steps:       []uint64{0, 1, 2, 3, 3, 4, 2},
+			snapshots:   []uint64{2},
+			wantSeq:     4,
+			wantFetches: 1,
+		},
+		{
+			name:        "a gap fetches a snapshot",
+			steps:       []uint64{0, 1, 3, 4},
+			snapshots:   []uint64{0, 2},
+			wantSeq:     4,
+			wantFetches: 2,
+		},
+		{
+			name:        "a gap fetches a snapshot that covers the held deltas",
+			steps:       []uint64{0, 1, 4},
+			snapshots:   []uint64{0, 4},
+			wantSeq:     4,
+			wantFetches: 2,
+		},
+		{
+			name:        "deltas are held until the gap is filled",
+			steps:       []uint64{0, 1, 3, 4, 2},
+			snapshots:   []uint64{0, 1},
+			wantSeq:     4,
+			wantFetches: 3,
+		},
+		{
+			name:        "deltas before the first sync are applied after it",
+			steps:       []uint64{2, 3, 1, 0},
+			snapshots:   []uint64{1},
+			wantSeq:     3,
+			wantFetches: 1,
+		},
+		{
+			name:        "deltas before the first sync are dropped if it covers them",
+			steps:       []uint64{1, 2, 0},
+			snapshots:   []uint64{3},
+			wantSeq:     3,
+			wantFetches: 1,
+		},
+	}
+	server := newTestServer(t, testSpawns...)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetches := 0
+			gs := newTestGameState("alice")
+			m := NewMirror(gs, server.fetcher(tt.snapshots, &fetches))
+			ctx := context.Background()
+			for _, seq := range tt.steps {
+				if seq == 0 {
+					err := m.Sync(ctx)
+					if err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				m.HandleDelta(ctx, server.delta(seq))
+			}
+
+			seq, synced := m.Seq()
+			if !synced || seq != tt.wantSeq {
+				t.Errorf("mirror at %d (synced %t), want %d", seq, synced, tt.wantSeq)
+			}
+			if fetches != tt.wantFetches {
+				t.Errorf("fetched %d snapshots, want %d", fetches, tt.wantFetches)
+			}
+			if got, want := m.world.Snapshot(), server.snapshots[tt.wantSeq]; !reflect.DeepEqual(got, want) {
+				t.Errorf("mirror world is\n%+v\nwant\n%+v", got, want)
+			}
+			if got, want := len(gs.GetPlayerSnap().Units), len(server.snapshots[tt.wantSeq].Players[0].Units); got != want {
+				t.Errorf("alice has %d units, want %d", got, want)
+			}
+		})
+	}
+}
+
+// The answer to the player's order must arrive however the mirror learns of
+// it, including when a snapshot covers the delta that carried it.
+func TestMirrorAnswersOwnOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		// before are the steps before alice sends her order, which delta 3
+		// carries, and after the steps once she has.
+		before, after []uint64
+		// broadcast, if set, is the snapshot the server broadcasts as soon
+		// as the order is sent.
+		broadcast uint64
+		snapshots []uint64
+	}{
+		{
+			name:      "in order",
+			before:    []uint64{0, 1, 2},
+			after:     []uint64{3},
+			snapshots: []uint64{0},
+		},
+		{
+			name:      "after a gap",
+			before:    []uint64{0, 1},
+			after:     []uint64{3},
+			snapshots: []uint64{0, 3},
+		},
+		{
+			name:      "before the first sync",
+			after:     []uint64{3, 0},
+			snapshots: []uint64{3},
+		},
+		{
+			name:      "after a snapshot covering it",
+			before:    []uint64{0, 1, 2},
+			broadcast: 3,
+			after:     []uint64{3},
+			snapshots: []uint64{0},
+		},
+	}
+	server := newTestServer(t, testSpawns...)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetches := 0
+			gs := newTestGameState("alice")
+			m := NewMirror(gs, server.fetcher(tt.snapshots, &fetches))
+			ctx := context.Background()
+			run := func(steps []uint64) {
+				for _, seq := range steps {
+					if seq == 0 {
+						err := m.Sync(ctx)
+						if err != nil {
+							t.Fatal(err)
+						}
+						continue
+					}
+					m.HandleDelta(ctx, server.delta(seq))
+				}
+			}
+			run(tt.before)
+			gs.ExpectAnswer()
+			if tt.broadcast != 0 {
+				m.HandleSnapshot(server.snapshots[tt.broadcast])
+			}
+			run(tt.after)
+
+			ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+			defer cancel()
+			err := gs.AwaitAnswer(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			unit, ok := gs.GetUnit(server.delta(3).Units[0].ID)
+			if !ok || unit.Location != "scandinavia" {
+				t.Errorf("alice's artillery is %+v (found %t), want it in scandinavia", unit, ok)
+			}
+		})
+	}
+}
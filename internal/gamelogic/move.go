@@ -9,46 +9,25 @@ import (
 type MoveOutcome int
 
 const (
-	MoveOutcomeSamePlayer MoveOutcome = iota
+	MoveOutcomeRejected MoveOutcome = iota
 	MoveOutComeSafe
 	MoveOutcomeMakeWar
 )
 
-func (gs *GameState) HandleMove(move ArmyMove) MoveOutcome {
-	defer fmt.Println("------------------------")
-	player := gs.GetPlayerSnap()
-
-	fmt.Println()
-	fmt.Println("==== Move Detected ====")
-	fmt.Printf("%s is moving %v unit(s) to %s\n", move.Player.Username, len(move.Units), move.ToLocation)
-	for _, unit := range move.Units {
-		fmt.Printf("* %v\n", unit.Rank)
-	}
-
-	if player.Username == move.Player.Username {
-		return MoveOutcomeSamePlayer
+func (o MoveOutcome) String() string {
+	switch o {
+	case MoveOutcomeRejected:
+		return "rejected"
+	case MoveOutComeSafe:
+		return "safe"
+	case MoveOutcomeMakeWar:
+		return "make_war"
 	}
-
-	overlappingLocation := getOverlappingLocation(player, move.Player)
-	if overlappingLocation != "" {
-		fmt.Printf("You have units in %s! You are at war with %s!\n", overlappingLocation, move.Player.Username)
-		return MoveOutcomeMakeWar
-	}
-	fmt.Printf("You are safe from %s's units.\n", move.Player.Username)
-	return MoveOutComeSafe
-}
-
-func getOverlappingLocation(p1 Player, p2 Player) Location {
-	for _, u1 := range p1.Units {
-		for _, u2 := range p2.Units {
-			if u1.Location == u2.Location {
-				return u1.Location
-			}
-		}
-	}
-	return ""
+	return fmt.Sprintf("MoveOutcome(%d)", int(o))
 }
 
+// CommandMove checks a move command against the player's units and the map,
+// and returns the request to send to the server, which moves them.
 func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
 	if gs.isPaused() {
 		return ArmyMove{}, errors.New("the game is paused, you can not move units")
@@ -57,8 +36,7 @@ func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
 		return ArmyMove{}, errors.New("usage: move <location> <unitID> <unitID> <unitID> etc")
 	}
 	newLocation := Location(words[1])
-	locations := getAllLocations()
-	if _, ok := locations[newLocation]; !ok {
+	if !gs.worldMap.Has(newLocation) {
 		return ArmyMove{}, fmt.Errorf("error: %s is not a valid location", newLocation)
 	}
 	unitIDs := []int{}
@@ -77,16 +55,22 @@ func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
 		if !ok {
 			return ArmyMove{}, fmt.Errorf("error: unit with ID %v not found", unitID)
 		}
-		unit.Location = newLocation
-		gs.UpdateUnit(unit)
+		if len(newUnits) > 0 && unit.Location != newUnits[0].Location {
+			return ArmyMove{}, errors.New("error: units can only move together from the same territory")
+		}
 		newUnits = append(newUnits, unit)
 	}
+	_, err := gs.worldMap.route(newUnits[0].Location, newLocation, gs.rules.MoveRange)
+	if err != nil {
+		return ArmyMove{}, fmt.Errorf("error: %v", err)
+	}
+	for i := range newUnits {
+		newUnits[i].Location = newLocation
+	}
 
-	mv := ArmyMove{
+	return ArmyMove{
 		ToLocation: newLocation,
 		Units:      newUnits,
 		Player:     gs.GetPlayerSnap(),
-	}
-	fmt.Printf("Moved %v units to %s\n", len(mv.Units), mv.ToLocation)
-	return mv, nil
+	}, nil
 }
@@ -1,20 +1,19 @@
 package gamelogic
 
 import (
-	"fmt"
-
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
 func (gs *GameState) HandlePause(ps routing.PlayingState) pubsub.AckType {
-	defer fmt.Println("------------------------")
-	fmt.Println()
+	gs.logger.Info("playing state changed", "paused", ps.IsPaused)
+	defer gs.presenter.Println("------------------------")
+	gs.presenter.Println()
 	if ps.IsPaused {
-		fmt.Println("==== Pause Detected ====")
+		gs.presenter.Println("==== Pause Detected ====")
 		gs.pauseGame()
 	} else {
-		fmt.Println("==== Resume Detected ====")
+		gs.presenter.Println("==== Resume Detected ====")
 		gs.resumeGame()
 	}
 	return pubsub.Ack
@@ -0,0 +1,31 @@
+package gamelogic
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Presenter shows the player what is happening in the game. It is kept apart
+// from diagnostics, which go to a *slog.Logger, so logs can be captured or
+// silenced without scraping the REPL.
+type Presenter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewPresenter(w io.Writer) *Presenter {
+	return &Presenter{w: w}
+}
+
+func (p *Presenter) Printf(format string, a ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, format, a...)
+}
+
+func (p *Presenter) Println(a ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintln(p.w, a...)
+}
@@ -0,0 +1,43 @@
+package gamelogic
+
+import (
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+var (
+	ArmyMovesRoute = routing.NewRoute[ArmyMove](
+		"army_moves",
+		routing.ExchangePerilTopic,
+		routing.ArmyMovesPrefix+".{username}",
+		pubsub.JSON,
+	)
+	ArmySpawnsRoute = routing.NewRoute[ArmySpawn](
+		"army_spawns",
+		routing.ExchangePerilTopic,
+		routing.ArmySpawnsPrefix+".{username}",
+		pubsub.JSON,
+	)
+	// WorldDeltasRoute carries the server's changes to the World. username
+	// is the player whose request caused the change.
+	WorldDeltasRoute = routing.NewRoute[WorldDelta](
+		"world_deltas",
+		routing.ExchangePerilTopic,
+		routing.WorldDeltasPrefix+".{username}",
+		pubsub.JSON,
+	)
+	// WorldSnapshotsRoute carries the server's periodic WorldSnapshots.
+	WorldSnapshotsRoute = routing.NewRoute[WorldSnapshot](
+		"world_snapshots",
+		routing.ExchangePerilTopic,
+		routing.WorldSnapshotsPrefix,
+		pubsub.JSON,
+	)
+	// WorldSnapshotRoute is for Requesting the latest WorldSnapshot.
+	WorldSnapshotRoute = routing.NewRoute[WorldSnapshotRequest](
+		"world_snapshot",
+		routing.ExchangePerilDirect,
+		routing.WorldSnapshotKey,
+		pubsub.JSON,
+	)
+)
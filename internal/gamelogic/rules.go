@@ -0,0 +1,33 @@
+package gamelogic
+
+// Rules are the tunable parts of the game.
+type Rules struct {
+	// UnitPower is how much each unit of a rank adds to an army's power in
+	// a war.
+	UnitPower map[UnitRank]int `toml:"unit_power" yaml:"unit_power"`
+	// Map is the built-in map or map file the game is played on. See
+	// OpenMap.
+	Map string `toml:"map" yaml:"map"`
+	// MoveRange is how many hops units can move at once, along the shortest
+	// path. 0 means any distance.
+	MoveRange int `toml:"move_range" yaml:"move_range"`
+}
+
+func DefaultRules() Rules {
+	return Rules{
+		UnitPower: map[UnitRank]int{
+			RankInfantry:  1,
+			RankCavalry:   5,
+			RankArtillery: 10,
+		},
+		Map:       ClassicMapName,
+		MoveRange: 1,
+	}
+}
+
+// WithRules plays the game by rules instead of DefaultRules.
+func WithRules(rules Rules) GameStateOption {
+	return func(gs *GameState) {
+		gs.rules = rules
+	}
+}
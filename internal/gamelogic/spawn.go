@@ -5,30 +5,34 @@ import (
 	"fmt"
 )
 
-func (gs *GameState) CommandSpawn(words []string) error {
+// CommandSpawn checks a spawn command and returns the request to send to the
+// server, which spawns the unit.
+func (gs *GameState) CommandSpawn(words []string) (ArmySpawn, error) {
+	if gs.isPaused() {
+		return ArmySpawn{}, errors.New("the game is paused, you can not spawn units")
+	}
 	if len(words) < 3 {
-		return errors.New("usage: spawn <location> <rank>")
+		return ArmySpawn{}, errors.New("usage: spawn <location> <rank>")
 	}
 
-	locationName := words[1]
-	locations := getAllLocations()
-	if _, ok := locations[Location(locationName)]; !ok {
-		return fmt.Errorf("error: %s is not a valid location", locationName)
+	spawn := ArmySpawn{
+		Username: gs.GetUsername(),
+		Location: Location(words[1]),
+		Rank:     UnitRank(words[2]),
+	}
+	err := validateSpawn(gs.worldMap, spawn.Location, spawn.Rank)
+	if err != nil {
+		return ArmySpawn{}, err
 	}
+	return spawn, nil
+}
 
-	rank := words[2]
-	units := getAllRanks()
-	if _, ok := units[UnitRank(rank)]; !ok {
+func validateSpawn(worldMap *Map, location Location, rank UnitRank) error {
+	if !worldMap.Has(location) {
+		return fmt.Errorf("error: %s is not a valid location", location)
+	}
+	if _, ok := getAllRanks()[rank]; !ok {
 		return fmt.Errorf("error: %s is not a valid unit", rank)
 	}
-
-	id := len(gs.getUnitsSnap()) + 1
-	gs.addUnit(Unit{
-		ID:       id,
-		Rank:     UnitRank(rank),
-		Location: Location(locationName),
-	})
-
-	fmt.Printf("Spawned a(n) %s in %s with id %v\n", rank, locationName, id)
 	return nil
 }
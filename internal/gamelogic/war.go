@@ -2,104 +2,104 @@ package gamelogic
 
 import (
 	"fmt"
+	"sort"
 )
 
 type WarOutcome int
 
 const (
-	WarOutcomeNotInvolved WarOutcome = iota
-	WarOutcomeNoUnits
-	WarOutcomeYouWon
-	WarOutcomeOpponentWon
+	WarOutcomeAttackerWon WarOutcome = iota
+	WarOutcomeDefenderWon
 	WarOutcomeDraw
 )
 
-func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, winner string, loser string) {
-	defer fmt.Println("------------------------")
-	fmt.Println()
-	fmt.Println("==== War Declared ====")
-	fmt.Printf("%s has declared war on %s!\n", rw.Attacker.Username, rw.Defender.Username)
-
-	player := gs.GetPlayerSnap()
-
-	if player.Username == rw.Defender.Username {
-		fmt.Printf("%s, you published the war.\n", player.Username)
-		return WarOutcomeNotInvolved, "", ""
+func (o WarOutcome) String() string {
+	switch o {
+	case WarOutcomeAttackerWon:
+		return "attacker_won"
+	case WarOutcomeDefenderWon:
+		return "defender_won"
+	case WarOutcomeDraw:
+		return "draw"
 	}
+	return fmt.Sprintf("WarOutcome(%d)", int(o))
+}
 
-	if player.Username != rw.Attacker.Username {
-		fmt.Printf("%s, you are not involved in this war.\n", player.Username)
-		return WarOutcomeNotInvolved, "", ""
+// Winner and Loser are empty for a draw.
+func (w War) Winner() string {
+	switch w.Outcome {
+	case WarOutcomeAttackerWon:
+		return w.Attacker
+	case WarOutcomeDefenderWon:
+		return w.Defender
 	}
+	return ""
+}
 
-	overlappingLocation := getOverlappingLocation(rw.Attacker, rw.Defender)
-	if overlappingLocation == "" {
-		fmt.Printf("Error! No units are in the same location. No war will be fought.\n")
-		return WarOutcomeNoUnits, "", ""
+func (w War) Loser() string {
+	switch w.Outcome {
+	case WarOutcomeAttackerWon:
+		return w.Defender
+	case WarOutcomeDefenderWon:
+		return w.Attacker
 	}
+	return ""
+}
 
-	attackerUnits := []Unit{}
-	defenderUnits := []Unit{}
-	for _, unit := range rw.Attacker.Units {
-		if unit.Location == overlappingLocation {
-			attackerUnits = append(attackerUnits, unit)
-		}
+// fight resolves a war in location between the attacker's and the defender's
+// units there. The loser's units in location are killed, or both sides' on a
+// draw.
+func fight(location Location, attacker, defender Player, rules Rules) War {
+	attackerUnits := unitsIn(attacker, location)
+	defenderUnits := unitsIn(defender, location)
+	war := War{
+		Location:      location,
+		Attacker:      attacker.Username,
+		Defender:      defender.Username,
+		AttackerPower: unitsToPowerLevel(attackerUnits, rules),
+		DefenderPower: unitsToPowerLevel(defenderUnits, rules),
+		Killed:        map[string][]int{},
 	}
-	for _, unit := range rw.Defender.Units {
-		if unit.Location == overlappingLocation {
-			defenderUnits = append(defenderUnits, unit)
-		}
+	switch {
+	case war.AttackerPower > war.DefenderPower:
+		war.Outcome = WarOutcomeAttackerWon
+		war.Killed[defender.Username] = unitIDs(defenderUnits)
+	case war.DefenderPower > war.AttackerPower:
+		war.Outcome = WarOutcomeDefenderWon
+		war.Killed[attacker.Username] = unitIDs(attackerUnits)
+	default:
+		war.Outcome = WarOutcomeDraw
+		war.Killed[attacker.Username] = unitIDs(attackerUnits)
+		war.Killed[defender.Username] = unitIDs(defenderUnits)
 	}
+	return war
+}
 
-	fmt.Printf("%s's units:\n", rw.Attacker.Username)
-	for _, unit := range attackerUnits {
-		fmt.Printf("  * %v\n", unit.Rank)
-	}
-	fmt.Printf("%s's units:\n", rw.Defender.Username)
-	for _, unit := range defenderUnits {
-		fmt.Printf("  * %v\n", unit.Rank)
-	}
-	attackerPower := unitsToPowerLevel(attackerUnits)
-	defenderPower := unitsToPowerLevel(defenderUnits)
-	fmt.Printf("Attacker has a power level of %v\n", attackerPower)
-	fmt.Printf("Defender has a power level of %v\n", defenderPower)
-	if attackerPower > defenderPower {
-		fmt.Printf("%s has won the war!\n", rw.Attacker.Username)
-		if player.Username == rw.Defender.Username {
-			fmt.Println("You have lost the war!")
-			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-			return WarOutcomeOpponentWon, rw.Attacker.Username, rw.Defender.Username
-		}
-		return WarOutcomeYouWon, rw.Attacker.Username, rw.Defender.Username
-	} else if defenderPower > attackerPower {
-		fmt.Printf("%s has won the war!\n", rw.Defender.Username)
-		if player.Username == rw.Attacker.Username {
-			fmt.Println("You have lost the war!")
-			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-			return WarOutcomeOpponentWon, rw.Defender.Username, rw.Attacker.Username
+func unitsIn(p Player, location Location) []Unit {
+	units := []Unit{}
+	for _, unit := range p.Units {
+		if unit.Location == location {
+			units = append(units, unit)
 		}
-		return WarOutcomeYouWon, rw.Defender.Username, rw.Attacker.Username
 	}
-	fmt.Println("The war ended in a draw!")
-	fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-	gs.removeUnitsInLocation(overlappingLocation)
-	return WarOutcomeDraw, rw.Attacker.Username, rw.Defender.Username
+	sort.Slice(units, func(i, j int) bool {
+		return units[i].ID < units[j].ID
+	})
+	return units
 }
 
-func unitsToPowerLevel(units []Unit) int {
+func unitIDs(units []Unit) []int {
+	ids := make([]int, 0, len(units))
+	for _, unit := range units {
+		ids = append(ids, unit.ID)
+	}
+	return ids
+}
+
+func unitsToPowerLevel(units []Unit, rules Rules) int {
 	power := 0
 	for _, unit := range units {
-		if unit.Rank == RankArtillery {
-			power += 10
-		}
-		if unit.Rank == RankCavalry {
-			power += 5
-		}
-		if unit.Rank == RankInfantry {
-			power += 1
-		}
+		power += rules.UnitPower[unit.Rank]
 	}
 	return power
 }
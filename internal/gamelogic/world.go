@@ -0,0 +1,370 @@
+package gamelogic
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+// World is the authoritative state of a game: every player's units and
+// whether the game is paused. The server keeps it and checks every spawn and
+// move against it, so clients can't forge their armies or anyone else's.
+//
+// Every change is made by applying a WorldDelta, the same deltas the server
+// publishes, so folding them yields the same world.
+type World struct {
+	mu         sync.RWMutex
+	players    map[string]Player
+	paused     bool
+	nextUnitID map[string]int
+	// seq is the Seq of the last delta applied.
+	seq   uint64
+	epoch string
+
+	rules    Rules
+	worldMap *Map
+	logger   *slog.Logger
+}
+
+func NewWorld(rules Rules, worldMap *Map, logger *slog.Logger) *World {
+	return &World{
+		players:    map[string]Player{},
+		nextUnitID: map[string]int{},
+		epoch:      newEpoch(),
+		rules:      rules,
+		worldMap:   worldMap,
+		logger:     logger,
+	}
+}
+
+// Spawn spawns a unit for spawn.Username, and fights a war if another player
+// holds the location.
+func (w *World) Spawn(spawn ArmySpawn) ([]WorldDelta, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.paused {
+		return nil, errors.New("the game is paused")
+	}
+	if spawn.Username == "" {
+		return nil, errors.New("spawn has no username")
+	}
+	err := validateSpawn(w.worldMap, spawn.Location, spawn.Rank)
+	if err != nil {
+		return nil, err
+	}
+
+	unit := Unit{
+		ID:       max(w.nextUnitID[spawn.Username], 1),
+		Rank:     spawn.Rank,
+		Location: spawn.Location,
+	}
+	delta := WorldDelta{
+		Kind:     DeltaSpawn,
+		Username: spawn.Username,
+		Units:    []Unit{unit},
+		Location: spawn.Location,
+	}
+	delta = w.commit(delta)
+	spawnsTotal.WithLabelValues(string(unit.Rank)).Inc()
+	w.logger.Debug("spawned unit", "player", spawn.Username, "id", unit.ID, "rank", unit.Rank, "location", unit.Location)
+
+	return append([]WorldDelta{delta}, w.fightIn(spawn.Username, spawn.Location)...), nil
+}
+
+// Move marches units of move.Player.Username from the territory they are in
+// along the shortest path to move.ToLocation, at most Rules.MoveRange hops.
+// They stop early in a territory another player holds, and fight a war
+// there, as they do if another player holds the destination. Only the unit
+// IDs in move are used.
+func (w *World) Move(move ArmyMove) (deltas []WorldDelta, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	outcome := MoveOutcomeRejected
+	defer func() {
+		movesTotal.WithLabelValues(outcome.String()).Inc()
+		w.logger.Debug("handled move",
+			"player", move.Player.Username,
+			"to", move.ToLocation,
+			"units", len(move.Units),
+			"outcome", outcome,
+			"error", err,
+		)
+	}()
+
+	if w.paused {
+		return nil, errors.New("the game is paused")
+	}
+	if len(move.Units) == 0 {
+		return nil, errors.New("move has no units")
+	}
+	player, ok := w.players[move.Player.Username]
+	if !ok {
+		return nil, fmt.Errorf("player %q has no units", move.Player.Username)
+	}
+	moved := []Unit{}
+	seen := map[int]bool{}
+	for _, u := range move.Units {
+		unit, ok := player.Units[u.ID]
+		if !ok {
+			return nil, fmt.Errorf("unit with ID %v not found", u.ID)
+		}
+		if seen[u.ID] {
+			return nil, fmt.Errorf("unit with ID %v is moved twice", u.ID)
+		}
+		seen[u.ID] = true
+		if len(moved) > 0 && unit.Location != moved[0].Location {
+			return nil, errors.New("units can only move together from the same territory")
+		}
+		moved = append(moved, unit)
+	}
+	path, err := w.worldMap.route(moved[0].Location, move.ToLocation, w.rules.MoveRange)
+	if err != nil {
+		return nil, err
+	}
+	for i, territory := range path[1:] {
+		if w.heldByOthers(move.Player.Username, territory) {
+			path = path[:i+2]
+			break
+		}
+	}
+	to := path[len(path)-1]
+	for i := range moved {
+		moved[i].Location = to
+	}
+
+	delta := WorldDelta{
+		Kind:     DeltaMove,
+		Username: move.Player.Username,
+		Units:    moved,
+		Location: to,
+		Path:     path,
+	}
+	delta = w.commit(delta)
+	wars := w.fightIn(move.Player.Username, to)
+	outcome = MoveOutComeSafe
+	if len(wars) > 0 {
+		outcome = MoveOutcomeMakeWar
+	}
+	return append([]WorldDelta{delta}, wars...), nil
+}
+
+// heldByOthers reports whether a player other than username has units in
+// territory.
+func (w *World) heldByOthers(username string, territory Location) bool {
+	for other, player := range w.players {
+		if other != username && len(unitsIn(player, territory)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// fightIn has attacker fight every other player with units in location, in
+// turn, until one side is gone.
+func (w *World) fightIn(attacker string, location Location) []WorldDelta {
+	defenders := []string{}
+	for username, player := range w.players {
+		if username != attacker && len(unitsIn(player, location)) > 0 {
+			defenders = append(defenders, username)
+		}
+	}
+	sort.Strings(defenders)
+
+	deltas := []WorldDelta{}
+	for _, defender := range defenders {
+		if len(unitsIn(w.players[attacker], location)) == 0 {
+			break
+		}
+		war := fight(location, w.players[attacker], w.players[defender], w.rules)
+		delta := WorldDelta{
+			Kind:     DeltaWar,
+			Username: attacker,
+			Location: location,
+			War:      &war,
+		}
+		delta = w.commit(delta)
+		warsTotal.WithLabelValues(war.Outcome.String()).Inc()
+		w.logger.Info("fought war",
+			"attacker", war.Attacker,
+			"defender", war.Defender,
+			"location", location,
+			"outcome", war.Outcome,
+		)
+		deltas = append(deltas, delta)
+	}
+	return deltas
+}
+
+func (w *World) SetPaused(paused bool) WorldDelta {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.commit(WorldDelta{Kind: DeltaPause, Paused: paused})
+}
+
+func (w *World) Paused() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.paused
+}
+
+// Player returns a copy of a player's army.
+func (w *World) Player(username string) (Player, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	player, ok := w.players[username]
+	if !ok {
+		return Player{}, false
+	}
+	return copyPlayer(player), true
+}
+
+// Apply applies a delta published by another World, such as the server's.
+func (w *World) Apply(d WorldDelta) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.apply(d)
+}
+
+// Seq is the sequence number of the last delta applied.
+func (w *World) Seq() uint64 {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.seq
+}
+
+// Snapshot is a copy of the whole world.
+func (w *World) Snapshot() WorldSnapshot {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	s := WorldSnapshot{
+		Seq:         w.seq,
+		Epoch:       w.epoch,
+		Paused:      w.paused,
+		Players:     []Player{},
+		NextUnitIDs: map[string]int{},
+	}
+	for _, username := range w.usernames() {
+		s.Players = append(s.Players, copyPlayer(w.players[username]))
+	}
+	for username, id := range w.nextUnitID {
+		s.NextUnitIDs[username] = id
+	}
+	return s
+}
+
+// Restore replaces the whole world with a snapshot.
+func (w *World) Restore(s WorldSnapshot) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.restore(s)
+}
+
+// Load replaces the whole world with a saved one, in a new epoch so mirrors
+// of the old world know to start over from its snapshot.
+func (w *World) Load(s WorldSnapshot) WorldSnapshot {
+	s.Epoch = newEpoch()
+	w.Restore(s)
+	return w.Snapshot()
+}
+
+func (w *World) restore(s WorldSnapshot) {
+	w.seq = s.Seq
+	w.epoch = s.Epoch
+	w.paused = s.Paused
+	w.players = map[string]Player{}
+	for _, player := range s.Players {
+		w.players[player.Username] = copyPlayer(player)
+	}
+	w.nextUnitID = map[string]int{}
+	for username, id := range s.NextUnitIDs {
+		w.nextUnitID[username] = id
+	}
+}
+
+func (w *World) Epoch() string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.epoch
+}
+
+// Players returns a copy of every player's army, by username.
+func (w *World) Players() []Player {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	players := []Player{}
+	for _, username := range w.usernames() {
+		players = append(players, copyPlayer(w.players[username]))
+	}
+	return players
+}
+
+func (w *World) usernames() []string {
+	usernames := make([]string, 0, len(w.players))
+	for username := range w.players {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+func copyPlayer(p Player) Player {
+	units := map[int]Unit{}
+	for id, unit := range p.Units {
+		units[id] = unit
+	}
+	return Player{Username: p.Username, Units: units}
+}
+
+// commit numbers a delta the world made and applies it.
+func (w *World) commit(d WorldDelta) WorldDelta {
+	d.Seq = w.seq + 1
+	d.Epoch = w.epoch
+	w.apply(d)
+	return d
+}
+
+func (w *World) apply(d WorldDelta) {
+	if d.Seq != 0 {
+		w.seq = d.Seq
+	}
+	switch d.Kind {
+	case DeltaSpawn, DeltaMove:
+		player := w.player(d.Username)
+		for _, unit := range d.Units {
+			player.Units[unit.ID] = unit
+			if unit.ID >= w.nextUnitID[d.Username] {
+				w.nextUnitID[d.Username] = unit.ID + 1
+			}
+		}
+	case DeltaWar:
+		for username, ids := range d.War.Killed {
+			player := w.player(username)
+			for _, id := range ids {
+				delete(player.Units, id)
+			}
+		}
+	case DeltaPause:
+		w.paused = d.Paused
+	}
+}
+
+func (w *World) player(username string) Player {
+	player, ok := w.players[username]
+	if !ok {
+		player = Player{Username: username, Units: map[int]Unit{}}
+		w.players[username] = player
+	}
+	return player
+}
+
+func newEpoch() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
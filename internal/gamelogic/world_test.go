@@ -0,0 +1,413 @@
+package gamelogic
+
+import (
+	"io"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// newTestWorld is a world on the line a - b - c - d, with the default unit
+// powers: infantry 1, cavalry 5, artillery 10.
+func newTestWorld(t *testing.T, moveRange int) *World {
+	t.Helper()
+	m, err := NewMap("line", map[Location][]Location{
+		"a": {"b"},
+		"b": {"c"},
+		"c": {"d"},
+		"d": nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := DefaultRules()
+	rules.MoveRange = moveRange
+	return NewWorld(rules, m, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func spawnAll(t *testing.T, w *World, spawns []ArmySpawn) {
+	t.Helper()
+	for _, spawn := range spawns {
+		if _, err := w.Spawn(spawn); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// armies lists every player's units, by username, ordered by ID. Players
+// without units are left out.
+func armies(w *World) map[string][]Unit {
+	armies := map[string][]Unit{}
+	for _, player := range w.Players() {
+		for _, unit := range player.Units {
+			armies[player.Username] = append(armies[player.Username], unit)
+		}
+	}
+	for _, units := range armies {
+		sort.Slice(units, func(i, j int) bool { return units[i].ID < units[j].ID })
+	}
+	return armies
+}
+
+// wars summarises deltas as their kinds, with the outcome of each war.
+func wars(deltas []WorldDelta) []string {
+	kinds := []string{}
+	for _, d := range deltas {
+		kind := string(d.Kind)
+		if d.War != nil {
+			kind += " " + d.War.Attacker + " " + d.War.Defender + " " + d.War.Outcome.String()
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+func TestWorldSpawn(t *testing.T) {
+	// Two other players only share a territory after a load.
+	sharing := []Player{
+		{Username: "bob", Units: map[int]Unit{1: {ID: 1, Rank: RankCavalry, Location: "a"}}},
+		{Username: "carol", Units: map[int]Unit{1: {ID: 1, Rank: RankInfantry, Location: "a"}}},
+	}
+	tests := []struct {
+		name       string
+		before     []ArmySpawn
+		restore    []Player
+		paused     bool
+		spawn      ArmySpawn
+		wantErr    string
+		wantDeltas []string
+		want       map[string][]Unit
+	}{
+		{
+			name:       "first unit",
+			spawn:      ArmySpawn{Username: "alice", Location: "a", Rank: RankInfantry},
+			wantDeltas: []string{"spawn"},
+			want:       map[string][]Unit{"alice": {{ID: 1, Rank: RankInfantry, Location: "a"}}},
+		},
+		{
+			name:       "IDs count up per player",
+			before:     []ArmySpawn{{Username: "alice", Location: "a", Rank: RankInfantry}, {Username: "bob", Location: "d", Rank: RankInfantry}},
+			spawn:      ArmySpawn{Username: "alice", Location: "b", Rank: RankCavalry},
+			wantDeltas: []string{"spawn"},
+			want: map[string][]Unit{
+				"alice": {{ID: 1, Rank: RankInfantry, Location: "a"}, {ID: 2, Rank: RankCavalry, Location: "b"}},
+				"bob":   {{ID: 1, Rank: RankInfantry, Location: "d"}},
+			},
+		},
+		{
+			name:   "attacker wins",
+			before: []ArmySpawn{{Username: "bob", Location: "a", Rank: RankCavalry}},
+			spawn:  ArmySpawn{Username: "alice", Location: "a", Rank: RankArtillery},
+			wantDeltas: []string{
+				"spawn",
+				"war alice bob attacker_won",
+			},
+			want: map[string][]Unit{"alice": {{ID: 1, Rank: RankArtillery, Location: "a"}}},
+		},
+		{
+			name:   "defender wins",
+			before: []ArmySpawn{{Username: "bob", Location: "a", Rank: RankCavalry}},
+			spawn:  ArmySpawn{Username: "alice", Location: "a", Rank: RankInfantry},
+			wantDeltas: []string{
+				"spawn",
+				"war alice bob defender_won",
+			},
+			want: map[string][]Unit{"bob": {{ID: 1, Rank: RankCavalry, Location: "a"}}},
+		},
+		{
+			name:   "draw kills both sides",
+			before: []ArmySpawn{{Username: "bob", Location: "a", Rank: RankInfantry}, {Username: "bob", Location: "b", Rank: RankInfantry}},
+			spawn:  ArmySpawn{Username: "alice", Location: "a", Rank: RankInfantry},
+			wantDeltas: []string{
+				"spawn",
+				"war alice bob draw",
+			},
+			want: map[string][]Unit{"bob": {{ID: 2, Rank: RankInfantry, Location: "b"}}},
+		},
+		{
+			name:    "fights every defender in turn",
+			restore: sharing,
+			spawn:   ArmySpawn{Username: "alice", Location: "a", Rank: RankArtillery},
+			wantDeltas: []string{
+				"spawn",
+				"war alice bob attacker_won",
+				"war alice carol attacker_won",
+			},
+			want: map[string][]Unit{"alice": {{ID: 1, Rank: RankArtillery, Location: "a"}}},
+		},
+		{
+			name:    "stops once the attacker is gone",
+			restore: sharing,
+			spawn:   ArmySpawn{Username: "alice", Location: "a", Rank: RankInfantry},
+			wantDeltas: []string{
+				"spawn",
+				"war alice bob defender_won",
+			},
+			want: map[string][]Unit{
+				"bob":   {{ID: 1, Rank: RankCavalry, Location: "a"}},
+				"carol": {{ID: 1, Rank: RankInfantry, Location: "a"}},
+			},
+		},
+		{
+			name:    "paused",
+			paused:  true,
+			spawn:   ArmySpawn{Username: "alice", Location: "a", Rank: RankInfantry},
+			wantErr: "paused",
+		},
+		{
+			name:    "no username",
+			spawn:   ArmySpawn{Location: "a", Rank: RankInfantry},
+			wantErr: "no username",
+		},
+		{
+			name:    "not on the map",
+			spawn:   ArmySpawn{Username: "alice", Location: "z", Rank: RankInfantry},
+			wantErr: "z is not a valid location",
+		},
+		{
+			name:    "unknown rank",
+			spawn:   ArmySpawn{Username: "alice", Location: "a", Rank: "dragon"},
+			wantErr: "dragon is not a valid unit",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWorld(t, 1)
+			if tt.restore != nil {
+				w.Restore(WorldSnapshot{Players: tt.restore})
+			}
+			spawnAll(t, w, tt.before)
+			before := armies(w)
+			w.SetPaused(tt.paused)
+
+			deltas, err := w.Spawn(tt.spawn)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				if got := armies(w); !reflect.DeepEqual(got, before) {
+					t.Errorf("refused spawn changed the world to %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := wars(deltas); !reflect.DeepEqual(got, tt.wantDeltas) {
+				t.Errorf("deltas are %q, want %q", got, tt.wantDeltas)
+			}
+			if got := armies(w); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("armies are %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorldMove(t *testing.T) {
+	alice := Player{Username: "alice"}
+	tests := []struct {
+		name       string
+		moveRange  int
+		before     []ArmySpawn
+		paused     bool
+		move       ArmyMove
+		wantErr    string
+		wantDeltas []string
+		wantPath   []Location
+		want       map[string][]Unit
+	}{
+		{
+			name:       "one hop",
+			moveRange:  1,
+			before:     []ArmySpawn{{Username: "alice", Location: "a", Rank: RankInfantry}},
+			move:       ArmyMove{Player: alice, Units: []Unit{{ID: 1}}, ToLocation: "b"},
+			wantDeltas: []string{"move"},
+			wantPath:   []Location{"a", "b"},
+			want:       map[string][]Unit{"alice": {{ID: 1, Rank: RankInfantry, Location: "b"}}},
+		},
+		{
+			name:      "only the units in the order move",
+			moveRange: 0,
+			before: []ArmySpawn{
+				{Username: "alice", Location: "a", Rank: RankInfantry},
+				{Username: "alice", Location: "a", Rank: RankCavalry},
+			},
+			move:       ArmyMove{Player: alice, Units: []Unit{{ID: 2, Rank: RankArtillery, Location: "d"}}, ToLocation: "d"},
+			wantDeltas: []string{"move"},
+			wantPath:   []Location{"a", "b", "c", "d"},
+			want: map[string][]Unit{"alice": {
+				{ID: 1, Rank: RankInfantry, Location: "a"},
+				{ID: 2, Rank: RankCavalry, Location: "d"},
+			}},
+		},
+		{
+			name:      "stops in territory another player holds",
+			moveRange: 0,
+			before: []ArmySpawn{
+				{Username: "alice", Location: "a", Rank: RankArtillery},
+				{Username: "bob", Location: "b", Rank: RankInfantry},
+			},
+			move:       ArmyMove{Player: alice, Units: []Unit{{ID: 1}}, ToLocation: "d"},
+			wantDeltas: []string{"move", "war alice bob attacker_won"},
+			wantPath:   []Location{"a", "b"},
+			want:       map[string][]Unit{"alice": {{ID: 1, Rank: RankArtillery, Location: "b"}}},
+		},
+		{
+			name:      "marches past its own units",
+			moveRange: 0,
+			before: []ArmySpawn{
+				{Username: "alice", Location: "a", Rank: RankInfantry},
+				{Username: "alice", Location: "b", Rank: RankInfantry},
+				{Username: "bob", Location: "c", Rank: RankArtillery},
+			},
+			move:       ArmyMove{Player: alice, Units: []Unit{{ID: 1}}, ToLocation: "d"},
+			wantDeltas: []string{"move", "war alice bob defender_won"},
+			wantPath:   []Location{"a", "b", "c"},
+			want: map[string][]Unit{
+				"alice": {{ID: 2, Rank: RankInfantry, Location: "b"}},
+				"bob":   {{ID: 1, Rank: RankArtillery, Location: "c"}},
+			},
+		},
+		{
+			name:      "out of range",
+			moveRange: 1,
+			before:    []ArmySpawn{{Username: "alice", Location: "a", Rank: RankInfantry}},
+			move:      ArmyMove{Player: alice, Units: []Unit{{ID: 1}}, ToLocation: "c"},
+			wantErr:   "c is 2 moves from a",
+		},
+		{
+			name:      "paused",
+			moveRange: 1,
+			before:    []ArmySpawn{{Username: "alice", Location: "a", Rank: RankInfantry}},
+			paused:    true,
+			move:      ArmyMove{Player: alice, Units: []Unit{{ID: 1}}, ToLocation: "b"},
+			wantErr:   "paused",
+		},
+		{
+			name:      "no units",
+			moveRange: 1,
+			before:    []ArmySpawn{{Username: "alice", Location: "a", Rank: RankInfantry}},
+			move:      ArmyMove{Player: alice, ToLocation: "b"},
+			wantErr:   "no units",
+		},
+		{
+			name:      "player without units",
+			moveRange: 1,
+			move:      ArmyMove{Player: alice, Units: []Unit{{ID: 1}}, ToLocation: "b"},
+			wantErr:   `player "alice" has no units`,
+		},
+		{
+			name:      "someone else's unit",
+			moveRange: 1,
+			before: []ArmySpawn{
+				{Username: "alice", Location: "a", Rank: RankInfantry},
+				{Username: "bob", Location: "c", Rank: RankInfantry},
+				{Username: "bob", Location: "c", Rank: RankInfantry},
+			},
+			move:    ArmyMove{Player: alice, Units: []Unit{{ID: 2}}, ToLocation: "b"},
+			wantErr: "unit with ID 2 not found",
+		},
+		{
+			name:      "unit moved twice",
+			moveRange: 1,
+			before:    []ArmySpawn{{Username: "alice", Location: "a", Rank: RankInfantry}},
+			move:      ArmyMove{Player: alice, Units: []Unit{{ID: 1}, {ID: 1}}, ToLocation: "b"},
+			wantErr:   "moved twice",
+		},
+		{
+			name:      "units in different territories",
+			moveRange: 0,
+			before: []ArmySpawn{
+				{Username: "alice", Location: "a", Rank: RankInfantry},
+				{Username: "alice", Location: "b", Rank: RankInfantry},
+			},
+			move:    ArmyMove{Player: alice, Units: []Unit{{ID: 1}, {ID: 2}}, ToLocation: "c"},
+			wantErr: "same territory",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWorld(t, tt.moveRange)
+			spawnAll(t, w, tt.before)
+			before := armies(w)
+			w.SetPaused(tt.paused)
+
+			deltas, err := w.Move(tt.move)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				if got := armies(w); !reflect.DeepEqual(got, before) {
+					t.Errorf("refused move changed the world to %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := wars(deltas); !reflect.DeepEqual(got, tt.wantDeltas) {
+				t.Errorf("deltas are %q, want %q", got, tt.wantDeltas)
+			}
+			if !reflect.DeepEqual(deltas[0].Path, tt.wantPath) {
+				t.Errorf("path is %v, want %v", deltas[0].Path, tt.wantPath)
+			}
+			if got := armies(w); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("armies are %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorldDeltaSequence(t *testing.T) {
+	w := newTestWorld(t, 0)
+	mirror := newTestWorld(t, 0)
+	epoch := w.Epoch()
+
+	var deltas []WorldDelta
+	record := func(ds []WorldDelta, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		deltas = append(deltas, ds...)
+	}
+	record(w.Spawn(ArmySpawn{Username: "alice", Location: "a", Rank: RankArtillery}))
+	record(w.Spawn(ArmySpawn{Username: "bob", Location: "c", Rank: RankInfantry}))
+	record(w.Move(ArmyMove{Player: Player{Username: "alice"}, Units: []Unit{{ID: 1}}, ToLocation: "d"}))
+	record([]WorldDelta{w.SetPaused(true)}, nil)
+
+	for i, d := range deltas {
+		if d.Seq != uint64(i+1) {
+			t.Errorf("delta %d (%s) has Seq %d, want %d", i, d.Kind, d.Seq, i+1)
+		}
+		if d.Epoch != epoch {
+			t.Errorf("delta %d (%s) has Epoch %q, want %q", i, d.Kind, d.Epoch, epoch)
+		}
+		mirror.Apply(d)
+	}
+	if w.Seq() != uint64(len(deltas)) {
+		t.Errorf("Seq is %d after %d deltas", w.Seq(), len(deltas))
+	}
+
+	// Folding the deltas yields the same world.
+	want := w.Snapshot()
+	got := mirror.Snapshot()
+	got.Epoch = want.Epoch
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("applying the deltas gives %+v, want %+v", got, want)
+	}
+
+	// Loading a save starts a new epoch from the save's Seq.
+	loaded := w.Load(want)
+	if loaded.Epoch == epoch {
+		t.Error("Load kept the epoch")
+	}
+	if loaded.Seq != want.Seq {
+		t.Errorf("Seq is %d after Load, want %d", loaded.Seq, want.Seq)
+	}
+	if d := w.SetPaused(false); d.Seq != want.Seq+1 || d.Epoch != loaded.Epoch {
+		t.Errorf("delta after Load has Seq %d in %q, want %d in %q", d.Seq, d.Epoch, want.Seq+1, loaded.Epoch)
+	}
+}
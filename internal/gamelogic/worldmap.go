@@ -0,0 +1,296 @@
+package gamelogic
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ClassicMapName names the built-in map, ClassicMap.
+const ClassicMapName = "classic"
+
+//go:embed maps/classic.yaml
+var classicMapFile []byte
+
+// Map is the board a game is played on: territories, and the territories
+// next to each, which units can move between in one hop. Adjacency is always
+// two-way.
+type Map struct {
+	name     string
+	adjacent map[Location][]Location
+}
+
+// mapFile is how a Map is written in a JSON or YAML map file.
+type mapFile struct {
+	Name string `json:"name" yaml:"name"`
+	// Territories lists the territories next to each territory.
+	Territories map[Location][]Location `json:"territories" yaml:"territories"`
+}
+
+// NewMap builds a map from the territories next to each territory. A border
+// only needs listing on one side, but every territory it names must be on
+// the map.
+func NewMap(name string, territories map[Location][]Location) (*Map, error) {
+	if len(territories) == 0 {
+		return nil, errors.New("map has no territories")
+	}
+	m := &Map{
+		name:     name,
+		adjacent: map[Location][]Location{},
+	}
+	for territory := range territories {
+		if territory == "" {
+			return nil, errors.New("map has a territory with no name")
+		}
+		m.adjacent[territory] = nil
+	}
+	seen := map[[2]Location]bool{}
+	link := func(from, to Location) {
+		if !seen[[2]Location{from, to}] {
+			seen[[2]Location{from, to}] = true
+			m.adjacent[from] = append(m.adjacent[from], to)
+		}
+	}
+	for territory, neighbours := range territories {
+		for _, neighbour := range neighbours {
+			if _, ok := territories[neighbour]; !ok {
+				return nil, fmt.Errorf("%s borders %s, which is not on the map", territory, neighbour)
+			}
+			if neighbour == territory {
+				return nil, fmt.Errorf("%s borders itself", territory)
+			}
+			link(territory, neighbour)
+			link(neighbour, territory)
+		}
+	}
+	// Sorted, so paths through the map don't depend on map iteration order.
+	for _, neighbours := range m.adjacent {
+		sort.Slice(neighbours, func(i, j int) bool {
+			return neighbours[i] < neighbours[j]
+		})
+	}
+	return m, nil
+}
+
+// LoadMap reads a map from a .json, .yaml or .yml file.
+func LoadMap(path string) (*Map, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read map file: %v", err)
+	}
+	var file mapFile
+	switch filepath.Ext(path) {
+	case ".json":
+		err = decodeMapJSON(data, &file)
+	case ".yaml", ".yml":
+		err = decodeMapYAML(data, &file)
+	default:
+		return nil, fmt.Errorf("map file %s must be .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse map file %s: %v", path, err)
+	}
+	m, err := NewMap(file.Name, file.Territories)
+	if err != nil {
+		return nil, fmt.Errorf("map file %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// decodeMapJSON rejects unknown fields, as decodeMapYAML does, so a
+// misspelt key isn't silently ignored.
+func decodeMapJSON(data []byte, file *mapFile) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(file)
+	if err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after the map")
+	}
+	return nil
+}
+
+func decodeMapYAML(data []byte, file *mapFile) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	return decoder.Decode(file)
+}
+
+// ClassicMap is the built-in world map of 42 territories.
+func ClassicMap() *Map {
+	var file mapFile
+	err := decodeMapYAML(classicMapFile, &file)
+	if err != nil {
+		panic(fmt.Sprintf("built-in map: %v", err))
+	}
+	m, err := NewMap(file.Name, file.Territories)
+	if err != nil {
+		panic(fmt.Sprintf("built-in map: %v", err))
+	}
+	return m
+}
+
+// OpenMap returns the built-in map called name, or else loads the map file
+// at name. An empty name is the classic map.
+func OpenMap(name string) (*Map, error) {
+	if name == "" || name == ClassicMapName {
+		return ClassicMap(), nil
+	}
+	return LoadMap(name)
+}
+
+func (m *Map) Name() string {
+	return m.name
+}
+
+// Territories lists every territory on the map, sorted.
+func (m *Map) Territories() []Location {
+	territories := make([]Location, 0, len(m.adjacent))
+	for territory := range m.adjacent {
+		territories = append(territories, territory)
+	}
+	sort.Slice(territories, func(i, j int) bool {
+		return territories[i] < territories[j]
+	})
+	return territories
+}
+
+func (m *Map) Has(territory Location) bool {
+	_, ok := m.adjacent[territory]
+	return ok
+}
+
+// Adjacent lists the territories next to territory, sorted.
+func (m *Map) Adjacent(territory Location) []Location {
+	return append([]Location(nil), m.adjacent[territory]...)
+}
+
+func (m *Map) IsAdjacent(from, to Location) bool {
+	for _, neighbour := range m.adjacent[from] {
+		if neighbour == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ShortestPath finds the fewest hops from one territory to another. The path
+// starts with from and ends with to, and is the same every time for the same
+// map. It reports false if to can't be reached.
+func (m *Map) ShortestPath(from, to Location) ([]Location, bool) {
+	if !m.Has(from) || !m.Has(to) {
+		return nil, false
+	}
+	previous := map[Location]Location{from: from}
+	queue := []Location{from}
+	for len(queue) > 0 {
+		territory := queue[0]
+		queue = queue[1:]
+		if territory == to {
+			path := []Location{to}
+			for territory != from {
+				territory = previous[territory]
+				path = append(path, territory)
+			}
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+			return path, true
+		}
+		for _, neighbour := range m.adjacent[territory] {
+			if _, ok := previous[neighbour]; !ok {
+				previous[neighbour] = territory
+				queue = append(queue, neighbour)
+			}
+		}
+	}
+	return nil, false
+}
+
+// route is the path units in from take to reach to, if it is at most
+// moveRange hops long. A moveRange of 0 or less means any distance.
+func (m *Map) route(from, to Location, moveRange int) ([]Location, error) {
+	if !m.Has(to) {
+		return nil, fmt.Errorf("%s is not a valid location", to)
+	}
+	if from == to {
+		return nil, fmt.Errorf("the units are already in %s", to)
+	}
+	path, ok := m.ShortestPath(from, to)
+	if !ok {
+		return nil, fmt.Errorf("there is no way from %s to %s", from, to)
+	}
+	hops := len(path) - 1
+	if moveRange > 0 && hops > moveRange {
+		return nil, fmt.Errorf("%s is %d moves from %s, but units can only move %d at a time", to, hops, from, moveRange)
+	}
+	return path, nil
+}
+
+// MarshalJSON writes the map in the same form as a JSON map file, so a map
+// can be recorded alongside the game played on it.
+func (m *Map) MarshalJSON() ([]byte, error) {
+	return json.Marshal(mapFile{Name: m.name, Territories: m.adjacent})
+}
+
+func (m *Map) UnmarshalJSON(data []byte) error {
+	var file mapFile
+	err := decodeMapJSON(data, &file)
+	if err != nil {
+		return err
+	}
+	parsed, err := NewMap(file.Name, file.Territories)
+	if err != nil {
+		return err
+	}
+	*m = *parsed
+	return nil
+}
+
+// CommandMap shows the map: every territory and its neighbours, one
+// territory's neighbours, or the shortest path between two territories.
+func (gs *GameState) CommandMap(words []string) error {
+	m := gs.worldMap
+	for _, word := range words[1:] {
+		if !m.Has(Location(word)) {
+			return fmt.Errorf("error: %s is not a valid location", word)
+		}
+	}
+	switch len(words) {
+	case 1:
+		gs.presenter.Printf("The %s map has %d territories.\n", m.Name(), len(m.adjacent))
+		for _, territory := range m.Territories() {
+			gs.presenter.Printf("* %s: %s\n", territory, joinLocations(m.Adjacent(territory)))
+		}
+	case 2:
+		territory := Location(words[1])
+		gs.presenter.Printf("%s borders %s\n", territory, joinLocations(m.Adjacent(territory)))
+	case 3:
+		path, ok := m.ShortestPath(Location(words[1]), Location(words[2]))
+		if !ok {
+			return fmt.Errorf("error: there is no way from %s to %s", words[1], words[2])
+		}
+		gs.presenter.Printf("%d moves: %s\n", len(path)-1, joinLocations(path))
+	default:
+		return errors.New("usage: map [<location> [<location>]]")
+	}
+	return nil
+}
+
+func joinLocations(locations []Location) string {
+	names := make([]string, len(locations))
+	for i, location := range locations {
+		names[i] = string(location)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,250 @@
+package gamelogic
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewMap(t *testing.T) {
+	tests := []struct {
+		name        string
+		territories map[Location][]Location
+		wantErr     string
+		// want is every territory's neighbours, if the map is valid.
+		want map[Location][]Location
+	}{
+		{
+			name:        "no territories",
+			territories: map[Location][]Location{},
+			wantErr:     "no territories",
+		},
+		{
+			name:        "unnamed territory",
+			territories: map[Location][]Location{"": nil, "a": nil},
+			wantErr:     "no name",
+		},
+		{
+			name:        "unknown neighbour",
+			territories: map[Location][]Location{"a": {"b"}},
+			wantErr:     "a borders b, which is not on the map",
+		},
+		{
+			name:        "borders itself",
+			territories: map[Location][]Location{"a": {"a"}},
+			wantErr:     "a borders itself",
+		},
+		{
+			name:        "one territory",
+			territories: map[Location][]Location{"a": nil},
+			want:        map[Location][]Location{"a": nil},
+		},
+		{
+			name:        "border listed on one side",
+			territories: map[Location][]Location{"a": {"b"}, "b": nil},
+			want:        map[Location][]Location{"a": {"b"}, "b": {"a"}},
+		},
+		{
+			name:        "border listed on both sides",
+			territories: map[Location][]Location{"a": {"b"}, "b": {"a"}},
+			want:        map[Location][]Location{"a": {"b"}, "b": {"a"}},
+		},
+		{
+			name:        "neighbours are sorted",
+			territories: map[Location][]Location{"a": {"d", "c"}, "b": {"a"}, "c": nil, "d": nil},
+			want:        map[Location][]Location{"a": {"b", "c", "d"}, "b": {"a"}, "c": {"a"}, "d": {"a"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMap("test", tt.territories)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[Location][]Location{}
+			for _, territory := range m.Territories() {
+				got[territory] = m.Adjacent(territory)
+				if len(got[territory]) == 0 {
+					got[territory] = nil
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("adjacency is %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShortestPath(t *testing.T) {
+	// a - b - c - d, with a shortcut a - e - d, and f on its own.
+	m, err := NewMap("test", map[Location][]Location{
+		"a": {"b", "e"},
+		"b": {"c"},
+		"c": {"d"},
+		"d": {"e"},
+		"e": nil,
+		"f": nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		from, to Location
+		want     []Location
+		wantOK   bool
+	}{
+		{name: "same territory", from: "a", to: "a", want: []Location{"a"}, wantOK: true},
+		{name: "neighbour", from: "a", to: "b", want: []Location{"a", "b"}, wantOK: true},
+		{name: "neighbour the other way", from: "b", to: "a", want: []Location{"b", "a"}, wantOK: true},
+		{name: "two hops", from: "a", to: "c", want: []Location{"a", "b", "c"}, wantOK: true},
+		{name: "shortcut", from: "a", to: "d", want: []Location{"a", "e", "d"}, wantOK: true},
+		{name: "unreachable", from: "a", to: "f"},
+		{name: "isolated", from: "f", to: "a"},
+		{name: "unknown destination", from: "a", to: "z"},
+		{name: "unknown origin", from: "z", to: "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := m.ShortestPath(tt.from, tt.to)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("path is %v, %t, want %v, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRoute(t *testing.T) {
+	m, err := NewMap("test", map[Location][]Location{
+		"a": {"b"},
+		"b": {"c"},
+		"c": nil,
+		"f": nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		from, to  Location
+		moveRange int
+		want      []Location
+		wantErr   string
+	}{
+		{name: "in range", from: "a", to: "b", moveRange: 1, want: []Location{"a", "b"}},
+		{name: "out of range", from: "a", to: "c", moveRange: 1, wantErr: "c is 2 moves from a"},
+		{name: "any distance", from: "a", to: "c", moveRange: 0, want: []Location{"a", "b", "c"}},
+		{name: "already there", from: "a", to: "a", moveRange: 1, wantErr: "already in a"},
+		{name: "unreachable", from: "a", to: "f", moveRange: 0, wantErr: "no way from a to f"},
+		{name: "not on the map", from: "a", to: "z", moveRange: 0, wantErr: "z is not a valid location"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.route(tt.from, tt.to, tt.moveRange)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("route is %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassicMap(t *testing.T) {
+	m := ClassicMap()
+	if got := len(m.Territories()); got != 42 {
+		t.Errorf("classic map has %d territories, want 42", got)
+	}
+	for _, territory := range m.Territories() {
+		for _, neighbour := range m.Adjacent(territory) {
+			if !m.IsAdjacent(neighbour, territory) {
+				t.Errorf("%s borders %s, but not the other way", territory, neighbour)
+			}
+		}
+	}
+	// Every territory can reach every other.
+	for _, territory := range m.Territories() {
+		if _, ok := m.ShortestPath("alaska", territory); !ok {
+			t.Errorf("no way from alaska to %s", territory)
+		}
+	}
+}
+
+func TestLoadMap(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{name: "yaml", path: write("ok.yaml", "name: islands\nterritories:\n  a: [b]\n  b: []\n")},
+		{name: "json", path: write("ok.json", `{"name": "islands", "territories": {"a": ["b"], "b": []}}`)},
+		{name: "unknown field", path: write("field.yaml", "name: islands\nborders: {}\n"), wantErr: "could not parse"},
+		{name: "unknown json field", path: write("field.json", `{"name": "islands", "borders": {}}`), wantErr: `unknown field "borders"`},
+		{name: "trailing json", path: write("trailing.json", `{"name": "islands", "territories": {}} {}`), wantErr: "unexpected data"},
+		{name: "unknown neighbour", path: write("bad.yaml", "name: islands\nterritories:\n  a: [c]\n"), wantErr: "a borders c"},
+		{name: "unknown extension", path: write("map.txt", ""), wantErr: "must be .json, .yaml or .yml"},
+		{name: "missing", path: filepath.Join(dir, "missing.yaml"), wantErr: "could not read map file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := LoadMap(tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Name() != "islands" || !m.IsAdjacent("b", "a") {
+				t.Errorf("loaded %s with b next to %v", m.Name(), m.Adjacent("b"))
+			}
+		})
+	}
+}
+
+func TestMapJSONRoundTrip(t *testing.T) {
+	data, err := json.Marshal(ClassicMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m Map
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&m, ClassicMap()) {
+		t.Error("map changed in a JSON round trip")
+	}
+
+	err = json.Unmarshal([]byte(`{"name": "islands", "territories": {"a": []}, "borders": {}}`), &m)
+	if err == nil || !strings.Contains(err.Error(), `unknown field "borders"`) {
+		t.Errorf("got %v, want an unknown field error", err)
+	}
+}
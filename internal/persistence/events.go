@@ -0,0 +1,132 @@
+package persistence
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// EventLog appends events to a file, one JSON object per line. Events are
+// never rewritten, and keep their sequence numbers across restarts.
+type EventLog struct {
+	mu  sync.Mutex
+	f   *os.File
+	seq uint64
+}
+
+// OpenEventLog opens the log at path, creating it if needed. A last line
+// left half-written by a crash is cut off; anything else unreadable is an
+// error, since the events after it would be lost.
+func OpenEventLog(path string) (*EventLog, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	l := &EventLog{f: f}
+	end, err := l.scan()
+	if err == nil {
+		err = f.Truncate(end)
+	}
+	if err == nil {
+		_, err = f.Seek(end, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("event log %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// scan finds the last event in the log, and where the last complete line
+// ends.
+func (l *EventLog) scan() (int64, error) {
+	r := bufio.NewReader(l.f)
+	var end int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// A line without its newline was cut short by a crash.
+			return end, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		var e gamelogic.Event
+		err = json.Unmarshal(line, &e)
+		if err != nil {
+			return 0, fmt.Errorf("event after %d: %w", l.seq, err)
+		}
+		if e.Seq != l.seq+1 {
+			return 0, fmt.Errorf("event %d follows event %d", e.Seq, l.seq)
+		}
+		l.seq = e.Seq
+		end += int64(len(line))
+	}
+}
+
+// Append numbers e after the last event in the log and writes it.
+func (l *EventLog) Append(e gamelogic.Event) (gamelogic.Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.Seq = l.seq + 1
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+	_, err = l.f.Write(append(data, '\n'))
+	if err != nil {
+		return e, err
+	}
+	l.seq = e.Seq
+	return e, nil
+}
+
+func (l *EventLog) Close() error {
+	return l.f.Close()
+}
+
+// EventReader reads the events in a log, in order.
+type EventReader struct {
+	r    *bufio.Reader
+	last uint64
+}
+
+func NewEventReader(r io.Reader) *EventReader {
+	return &EventReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next event, or io.EOF after the last one. A last line
+// without its newline was left half-written by a crash, and is taken as the
+// end of the log, as OpenEventLog would cut it off. A complete line that
+// can't be read is an error wherever it is, and so are events out of
+// sequence.
+func (r *EventReader) Next() (gamelogic.Event, error) {
+	var e gamelogic.Event
+	line, err := r.r.ReadBytes('\n')
+	if errors.Is(err, io.EOF) {
+		return e, io.EOF
+	}
+	if err != nil {
+		return e, err
+	}
+	err = json.Unmarshal(line, &e)
+	if err != nil {
+		return e, fmt.Errorf("event after %d: %w", r.last, err)
+	}
+	if e.Seq != r.last+1 {
+		return e, fmt.Errorf("event %d follows event %d", e.Seq, r.last)
+	}
+	r.last = e.Seq
+	return e, nil
+}
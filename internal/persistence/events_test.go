@@ -0,0 +1,274 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// testEvents plays a short game on a World and returns the events the
+// server would record for it: a start, two spawns, a move into a war and a
+// pause. The events aren't numbered yet.
+func testEvents(t *testing.T) ([]gamelogic.Event, gamelogic.WorldSnapshot) {
+	t.Helper()
+	rules := gamelogic.DefaultRules()
+	worldMap := gamelogic.ClassicMap()
+	world := gamelogic.NewWorld(rules, worldMap, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	start := world.Snapshot()
+	events := []gamelogic.Event{{
+		Kind:     gamelogic.EventStart,
+		Rules:    &rules,
+		Map:      worldMap,
+		Snapshot: &start,
+	}}
+
+	spawns := []gamelogic.ArmySpawn{
+		{Username: "alice", Location: "ukraine", Rank: gamelogic.RankInfantry},
+		{Username: "bob", Location: "ural", Rank: gamelogic.RankArtillery},
+	}
+	for _, spawn := range spawns {
+		deltas, err := world.Spawn(spawn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, gamelogic.Event{Kind: gamelogic.EventSpawn, Spawn: &spawn, Deltas: deltas})
+	}
+
+	bob, _ := world.Player("bob")
+	move := gamelogic.ArmyMove{Player: bob, ToLocation: "ukraine"}
+	for _, unit := range bob.Units {
+		move.Units = append(move.Units, unit)
+	}
+	deltas, err := world.Move(move)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events = append(events, gamelogic.Event{Kind: gamelogic.EventMove, Move: &move, Deltas: deltas})
+
+	events = append(events, gamelogic.Event{
+		Kind:   gamelogic.EventPause,
+		Paused: true,
+		Deltas: []gamelogic.WorldDelta{world.SetPaused(true)},
+	})
+	return events, world.Snapshot()
+}
+
+func appendEvents(t *testing.T, l *EventLog, events []gamelogic.Event) {
+	t.Helper()
+	for _, e := range events {
+		_, err := l.Append(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readEvents reads a whole log, replaying it as it goes.
+func readEvents(t *testing.T, r io.Reader) ([]gamelogic.Event, *gamelogic.Replay) {
+	t.Helper()
+	events := NewEventReader(r)
+	replay := gamelogic.NewReplay(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	var read []gamelogic.Event
+	for {
+		e, err := events.Next()
+		if errors.Is(err, io.EOF) {
+			return read, replay
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = replay.Step(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		read = append(read, e)
+	}
+}
+
+func TestEventLogRoundTrip(t *testing.T) {
+	events, want := testEvents(t)
+	tests := []struct {
+		name string
+		// sessions splits the events between opens of the log.
+		sessions []int
+	}{
+		{name: "one session", sessions: []int{len(events)}},
+		{name: "reopened after each event", sessions: []int{1, 1, 1, 1, 1}},
+		{name: "reopened mid-game", sessions: []int{2, 0, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "events.jsonl")
+			next := 0
+			for _, n := range tt.sessions {
+				l, err := OpenEventLog(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				appendEvents(t, l, events[next:next+n])
+				next += n
+				err = l.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			read, replay := readEvents(t, f)
+			if len(read) != len(events) {
+				t.Fatalf("read %d events, want %d", len(read), len(events))
+			}
+			for i, e := range read {
+				if e.Seq != uint64(i+1) {
+					t.Errorf("event %d has seq %d", i+1, e.Seq)
+				}
+				if e.Kind != events[i].Kind {
+					t.Errorf("event %d is a %s, want a %s", i+1, e.Kind, events[i].Kind)
+				}
+			}
+			got := replay.World().Snapshot()
+			got.Epoch, want.Epoch = "", ""
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("replayed world is\n%+v\nwant\n%+v", got, want)
+			}
+		})
+	}
+}
+
+func TestEventReaderTornTail(t *testing.T) {
+	events, _ := testEvents(t)
+	var log bytes.Buffer
+	for i, e := range events[:3] {
+		e.Seq = uint64(i + 1)
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.Write(append(data, '\n'))
+	}
+	last, err := json.Marshal(gamelogic.Event{Seq: 4, Kind: gamelogic.EventPause, Paused: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		tail string
+	}{
+		{name: "no tail", tail: ""},
+		{name: "half a line", tail: string(last[:len(last)/2])},
+		{name: "a whole event without its newline", tail: string(last)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			read, replay := readEvents(t, strings.NewReader(log.String()+tt.tail))
+			if len(read) != 3 {
+				t.Fatalf("read %d events, want 3", len(read))
+			}
+			if _, ok := replay.World().Player("bob"); !ok {
+				t.Error("bob's spawn was not replayed")
+			}
+		})
+	}
+}
+
+func TestEventReaderErrors(t *testing.T) {
+	line := func(e gamelogic.Event) string {
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data) + "\n"
+	}
+	pause := func(seq uint64) string {
+		return line(gamelogic.Event{Seq: seq, Kind: gamelogic.EventPause, Paused: true})
+	}
+	tests := []struct {
+		name    string
+		log     string
+		wantErr string
+	}{
+		{name: "unreadable line before the end", log: pause(1) + "{\"Seq\":\n" + pause(2), wantErr: "event after 1"},
+		// Only a line without its newline can be a torn write.
+		{name: "unreadable last line", log: pause(1) + "{\"Seq\":\n", wantErr: "event after 1"},
+		{name: "gap", log: pause(1) + pause(3), wantErr: "event 3 follows event 1"},
+		{name: "repeat", log: pause(1) + pause(1), wantErr: "event 1 follows event 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := NewEventReader(strings.NewReader(tt.log))
+			var err error
+			for err == nil {
+				_, err = events.Next()
+			}
+			if errors.Is(err, io.EOF) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOpenEventLogCorruptLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	data, err := json.Marshal(gamelogic.Event{Seq: 1, Kind: gamelogic.EventPause, Paused: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, append(data, []byte("\n{\"Seq\":\n")...), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = OpenEventLog(path)
+	if err == nil || !strings.Contains(err.Error(), "event after 1") {
+		t.Errorf("got %v, want an error containing %q", err, "event after 1")
+	}
+}
+
+func TestOpenEventLogCutsTornTail(t *testing.T) {
+	events, _ := testEvents(t)
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	l, err := OpenEventLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendEvents(t, l, events[:3])
+	l.Close()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"Seq":4,"Kind":"mo`)
+	f.Close()
+
+	l, err = OpenEventLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendEvents(t, l, events[3:])
+	l.Close()
+
+	f, err = os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	read, _ := readEvents(t, f)
+	if len(read) != len(events) {
+		t.Errorf("read %d events, want %d", len(read), len(events))
+	}
+}
@@ -0,0 +1,94 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// JSONStore keeps each save as <name>.json in a directory.
+type JSONStore struct {
+	dir string
+}
+
+func OpenJSONStore(dir string) (*JSONStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONStore{dir: dir}, nil
+}
+
+// Save writes to a temporary file first, so a crash mid-save leaves the
+// previous save intact.
+func (s *JSONStore) Save(name string, snapshot gamelogic.WorldSnapshot) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path(name))
+}
+
+func (s *JSONStore) Load(name string) (gamelogic.WorldSnapshot, error) {
+	if err := checkName(name); err != nil {
+		return gamelogic.WorldSnapshot{}, err
+	}
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return gamelogic.WorldSnapshot{}, ErrNotFound
+	}
+	if err != nil {
+		return gamelogic.WorldSnapshot{}, err
+	}
+	var snapshot gamelogic.WorldSnapshot
+	err = json.Unmarshal(data, &snapshot)
+	return snapshot, err
+}
+
+func (s *JSONStore) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if ok && !entry.IsDir() && checkName(name) == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *JSONStore) Close() error {
+	return nil
+}
+
+func (s *JSONStore) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
@@ -0,0 +1,90 @@
+package persistence
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS saves (
+	name     TEXT PRIMARY KEY,
+	saved_at TIMESTAMP NOT NULL,
+	world    TEXT NOT NULL
+)`
+
+// SQLiteStore keeps saves in a SQLite database, one row per save.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(sqliteSchema)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Save(name string, snapshot gamelogic.WorldSnapshot) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO saves (name, saved_at, world) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET saved_at = excluded.saved_at, world = excluded.world`,
+		name, time.Now().UTC(), string(data),
+	)
+	return err
+}
+
+func (s *SQLiteStore) Load(name string) (gamelogic.WorldSnapshot, error) {
+	if err := checkName(name); err != nil {
+		return gamelogic.WorldSnapshot{}, err
+	}
+	var data string
+	err := s.db.QueryRow(`SELECT world FROM saves WHERE name = ?`, name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return gamelogic.WorldSnapshot{}, ErrNotFound
+	}
+	if err != nil {
+		return gamelogic.WorldSnapshot{}, err
+	}
+	var snapshot gamelogic.WorldSnapshot
+	err = json.Unmarshal([]byte(data), &snapshot)
+	return snapshot, err
+}
+
+func (s *SQLiteStore) List() ([]string, error) {
+	rows, err := s.db.Query(`SELECT name FROM saves ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
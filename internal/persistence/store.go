@@ -0,0 +1,53 @@
+// Package persistence saves and loads the server's World, so a game
+// survives restarts.
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// CheckpointName is the save the server writes periodically and loads on
+// start-up.
+const CheckpointName = "checkpoint"
+
+var ErrNotFound = errors.New("no such save")
+
+// Store keeps named saves of the World.
+type Store interface {
+	Save(name string, s gamelogic.WorldSnapshot) error
+	// Load returns ErrNotFound if nothing was saved under name.
+	Load(name string) (gamelogic.WorldSnapshot, error)
+	// List returns the names of every save, sorted.
+	List() ([]string, error)
+	Close() error
+}
+
+// Open opens the store described by spec: "json:<directory>" for a JSON file
+// per save, or "sqlite:<file>" for a SQLite database.
+func Open(spec string) (Store, error) {
+	kind, path, ok := strings.Cut(spec, ":")
+	if !ok || path == "" {
+		return nil, fmt.Errorf("store %q should be json:<directory> or sqlite:<file>", spec)
+	}
+	switch kind {
+	case "json":
+		return OpenJSONStore(path)
+	case "sqlite":
+		return OpenSQLiteStore(path)
+	}
+	return nil, fmt.Errorf("unknown store kind %q", kind)
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func checkName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid save name %q: use letters, digits, - and _", name)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package persistence
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+func testSnapshot(seq uint64) gamelogic.WorldSnapshot {
+	return gamelogic.WorldSnapshot{
+		Seq:    seq,
+		Epoch:  "0123456789abcdef",
+		Paused: true,
+		Players: []gamelogic.Player{
+			{Username: "alice", Units: map[int]gamelogic.Unit{
+				1: {ID: 1, Rank: gamelogic.RankInfantry, Location: "ukraine"},
+				3: {ID: 3, Rank: gamelogic.RankArtillery, Location: "ural"},
+			}},
+			{Username: "bob", Units: map[int]gamelogic.Unit{}},
+		},
+		NextUnitIDs: map[string]int{"alice": 4, "bob": 2},
+	}
+}
+
+// stores opens one of each kind of Store in a temporary directory. The
+// SQLite store needs cgo, which mattn/go-sqlite3 is built with.
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+	dir := t.TempDir()
+	stores := map[string]Store{}
+	for kind, spec := range map[string]string{
+		"json":   "json:" + filepath.Join(dir, "saves"),
+		"sqlite": "sqlite:" + filepath.Join(dir, "peril.db"),
+	} {
+		store, err := Open(spec)
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		t.Cleanup(func() { store.Close() })
+		stores[kind] = store
+	}
+	return stores
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	for kind, store := range stores(t) {
+		t.Run(kind, func(t *testing.T) {
+			want := testSnapshot(7)
+			if err := store.Save("first", want); err != nil {
+				t.Fatal(err)
+			}
+			got, err := store.Load("first")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("loaded\n%+v\nwant\n%+v", got, want)
+			}
+
+			// Saving again under the same name replaces the save.
+			want = testSnapshot(9)
+			if err := store.Save("first", want); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := store.Load("first"); err != nil || !reflect.DeepEqual(got, want) {
+				t.Errorf("loaded %+v, %v after saving again, want %+v", got, err, want)
+			}
+
+			if err := store.Save(CheckpointName, testSnapshot(1)); err != nil {
+				t.Fatal(err)
+			}
+			names, err := store.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{CheckpointName, "first"}; !reflect.DeepEqual(names, want) {
+				t.Errorf("List() = %q, want %q", names, want)
+			}
+		})
+	}
+}
+
+func TestStoreErrors(t *testing.T) {
+	for kind, store := range stores(t) {
+		t.Run(kind, func(t *testing.T) {
+			if _, err := store.Load("missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Load of a missing save: got %v, want %v", err, ErrNotFound)
+			}
+			for _, name := range []string{"", "../escape", "a b", "a.json"} {
+				if err := store.Save(name, testSnapshot(1)); err == nil {
+					t.Errorf("saved under %q", name)
+				}
+				if _, err := store.Load(name); err == nil || errors.Is(err, ErrNotFound) {
+					t.Errorf("Load(%q) = %v, want an invalid name error", name, err)
+				}
+			}
+			names, err := store.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(names) != 0 {
+				t.Errorf("List() = %q after refused saves, want none", names)
+			}
+		})
+	}
+}
+
+func TestOpenSpec(t *testing.T) {
+	for _, spec := range []string{"", "json", "json:", "sqlite:", "bolt:saves.db"} {
+		if store, err := Open(spec); err == nil {
+			store.Close()
+			t.Errorf("Open(%q) succeeded", spec)
+		}
+	}
+}
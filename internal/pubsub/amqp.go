@@ -0,0 +1,651 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var ErrNotConnected = errors.New("not connected to the broker")
+
+const (
+	minReconnectDelay = 500 * time.Millisecond
+	maxReconnectDelay = 30 * time.Second
+)
+
+// AMQPBroker is a Broker backed by a RabbitMQ connection.
+//
+// The connection is managed: when it drops, the broker re-dials with
+// exponential backoff, re-declares every exchange, queue and binding that was
+// declared through it and resumes every consumer. Publishes and declarations
+// made while disconnected fail fast with ErrNotConnected.
+type AMQPBroker struct {
+	dial   func() (*amqp.Connection, error)
+	logger *slog.Logger
+	userID string
+
+	mu        sync.Mutex
+	conn      *amqp.Connection
+	publishCh *amqp.Channel
+	confirmCh *amqp.Channel
+	ready     chan struct{}
+	closing   chan struct{}
+	closed    bool
+
+	exchanges []declaredExchange
+	queues    []declaredQueue
+	bindings  []declaredBinding
+
+	confirmMu sync.Mutex
+	returns   chan amqp.Return
+}
+
+type declaredExchange struct {
+	name string
+	kind string
+}
+
+type declaredQueue struct {
+	name            string
+	simpleQueueType SimpleQueueType
+	args            amqp.Table
+}
+
+type declaredBinding struct {
+	queueName string
+	exchange  string
+	key       string
+}
+
+type AMQPOption func(*AMQPBroker)
+
+// WithBrokerLogger reports connection losses and reconnects to logger instead
+// of slog.Default().
+func WithBrokerLogger(logger *slog.Logger) AMQPOption {
+	return func(b *AMQPBroker) {
+		b.logger = logger
+	}
+}
+
+// WithUserID stamps every message published with userID, the user the
+// connection logs in as. RabbitMQ refuses messages whose user ID isn't the
+// publisher's login, so receivers can trust Envelope.UserID. Republished
+// deliveries keep their original user ID, which RabbitMQ only accepts from a
+// login tagged impersonator.
+func WithUserID(userID string) AMQPOption {
+	return func(b *AMQPBroker) {
+		b.userID = userID
+	}
+}
+
+func DialAMQP(url string, opts ...AMQPOption) (*AMQPBroker, error) {
+	return NewAMQPBroker(func() (*amqp.Connection, error) {
+		return amqp.Dial(url)
+	}, opts...)
+}
+
+// DialAMQPConfig is DialAMQP with connection settings such as TLS or the
+// vhost.
+func DialAMQPConfig(url string, config amqp.Config, opts ...AMQPOption) (*AMQPBroker, error) {
+	return NewAMQPBroker(func() (*amqp.Connection, error) {
+		return amqp.DialConfig(url, config)
+	}, opts...)
+}
+
+// NewAMQPBroker connects using dial, which is called again every time the
+// connection has to be re-established.
+func NewAMQPBroker(dial func() (*amqp.Connection, error), opts ...AMQPOption) (*AMQPBroker, error) {
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &AMQPBroker{
+		dial:    dial,
+		logger:  slog.Default(),
+		ready:   make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.setConnection(conn)
+	return b, nil
+}
+
+// setConnection installs a live connection and starts watching it.
+func (b *AMQPBroker) setConnection(conn *amqp.Connection) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.conn = conn
+	b.publishCh = nil
+	b.confirmCh = nil
+	close(b.ready)
+
+	go b.watch(conn.NotifyClose(make(chan *amqp.Error, 1)))
+}
+
+func (b *AMQPBroker) watch(closed <-chan *amqp.Error) {
+	amqpErr, ok := <-closed
+	if !ok || amqpErr == nil {
+		// The connection was closed on purpose.
+		return
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.logger.Warn("connection to broker lost", "error", amqpErr)
+	b.conn = nil
+	b.publishCh = nil
+	b.confirmCh = nil
+	b.ready = make(chan struct{})
+	b.mu.Unlock()
+
+	b.reconnect()
+}
+
+func (b *AMQPBroker) reconnect() {
+	delay := minReconnectDelay
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-b.closing:
+			return
+		case <-time.After(delay):
+		}
+
+		conn, err := b.dial()
+		if err == nil {
+			err = b.redeclare(conn)
+			if err != nil {
+				conn.Close()
+			}
+		}
+		if err != nil {
+			b.logger.Warn("reconnect attempt failed", "attempt", attempt, "error", err)
+			delay = min(delay*2, maxReconnectDelay)
+			continue
+		}
+
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			conn.Close()
+			return
+		}
+		b.mu.Unlock()
+
+		b.logger.Info("reconnected to broker", "attempts", attempt)
+		b.setConnection(conn)
+		return
+	}
+}
+
+// redeclare restores the topology recorded by DeclareExchange, DeclareQueue
+// and BindQueue on a fresh connection.
+func (b *AMQPBroker) redeclare(conn *amqp.Connection) error {
+	b.mu.Lock()
+	exchanges := append([]declaredExchange(nil), b.exchanges...)
+	queues := append([]declaredQueue(nil), b.queues...)
+	bindings := append([]declaredBinding(nil), b.bindings...)
+	b.mu.Unlock()
+
+	for _, ex := range exchanges {
+		if err := declareExchange(conn, ex.name, ex.kind); err != nil {
+			return fmt.Errorf("could not redeclare exchange %s: %v", ex.name, err)
+		}
+	}
+	for _, q := range queues {
+		if _, err := declareQueue(conn, q.name, q.simpleQueueType, q.args); err != nil {
+			return fmt.Errorf("could not redeclare queue %s: %v", q.name, err)
+		}
+	}
+	for _, binding := range bindings {
+		if err := bindQueue(conn, binding.queueName, binding.exchange, binding.key); err != nil {
+			return fmt.Errorf("could not rebind queue %s: %v", binding.queueName, err)
+		}
+	}
+	return nil
+}
+
+// connection returns the live connection, or ErrNotConnected.
+func (b *AMQPBroker) connection() (*amqp.Connection, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || b.conn == nil {
+		return nil, ErrNotConnected
+	}
+	return b.conn, nil
+}
+
+// waitConnected blocks until the broker is connected, returning false if the
+// broker is closed or done fires first.
+func (b *AMQPBroker) waitConnected(done <-chan struct{}) (*amqp.Connection, bool) {
+	for {
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			return nil, false
+		}
+		if b.conn != nil {
+			conn := b.conn
+			b.mu.Unlock()
+			return conn, true
+		}
+		ready := b.ready
+		b.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-done:
+			return nil, false
+		case <-b.closing:
+			return nil, false
+		}
+	}
+}
+
+// Publish sends msg, waiting for the broker's confirmation if opts asks for
+// it. Mandatory publishes are always confirmed, since a returned message can
+// only be reported once the broker has answered.
+func (b *AMQPBroker) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing, opts PublishOptions) error {
+	if b.userID != "" && !opts.Republish {
+		msg.UserId = b.userID
+	}
+	if opts.Confirm || opts.Mandatory {
+		return b.publishConfirmed(ctx, exchange, key, msg, opts.Mandatory)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || b.conn == nil {
+		return ErrNotConnected
+	}
+	if b.publishCh == nil || b.publishCh.IsClosed() {
+		ch, err := b.conn.Channel()
+		if err != nil {
+			return fmt.Errorf("could not create publish channel: %v", err)
+		}
+		b.publishCh = ch
+	}
+	return b.publishCh.PublishWithContext(ctx, exchange, key, false, false, msg)
+}
+
+// publishConfirmed publishes on a channel in confirm mode and waits for the
+// broker's answer. Confirmed publishes are serialised so that a basic.return
+// can be matched to the publish it belongs to: RabbitMQ always sends the
+// return before the ack of the same message.
+func (b *AMQPBroker) publishConfirmed(ctx context.Context, exchange, key string, msg amqp.Publishing, mandatory bool) error {
+	b.confirmMu.Lock()
+	defer b.confirmMu.Unlock()
+
+	ch, err := b.confirmChannel()
+	if err != nil {
+		return err
+	}
+
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, false, msg)
+	if err != nil {
+		return err
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		// The confirmation may still arrive later; start over on a fresh
+		// channel so it cannot be mistaken for the next publish's.
+		b.resetConfirmChannel()
+		return err
+	}
+	if !acked {
+		return ErrNacked
+	}
+
+	select {
+	case ret, ok := <-b.returns:
+		if !ok {
+			return nil
+		}
+		return &UnroutableError{
+			Exchange:  ret.Exchange,
+			Key:       ret.RoutingKey,
+			ReplyCode: ret.ReplyCode,
+			ReplyText: ret.ReplyText,
+		}
+	default:
+		return nil
+	}
+}
+
+// confirmChannel must be called with b.confirmMu held.
+func (b *AMQPBroker) confirmChannel() (*amqp.Channel, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || b.conn == nil {
+		return nil, ErrNotConnected
+	}
+	if b.confirmCh != nil && !b.confirmCh.IsClosed() {
+		return b.confirmCh, nil
+	}
+
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("could not create confirm channel: %v", err)
+	}
+	err = ch.Confirm(false)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("could not put channel in confirm mode: %v", err)
+	}
+	b.returns = ch.NotifyReturn(make(chan amqp.Return, 1))
+	b.confirmCh = ch
+	return ch, nil
+}
+
+// resetConfirmChannel must be called with b.confirmMu held.
+func (b *AMQPBroker) resetConfirmChannel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.confirmCh != nil {
+		b.confirmCh.Close()
+		b.confirmCh = nil
+	}
+}
+
+func (b *AMQPBroker) DeclareExchange(name, kind string) error {
+	conn, err := b.connection()
+	if err != nil {
+		return err
+	}
+	err = declareExchange(conn, name, kind)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ex := range b.exchanges {
+		if ex.name == name {
+			return nil
+		}
+	}
+	b.exchanges = append(b.exchanges, declaredExchange{name: name, kind: kind})
+	return nil
+}
+
+func declareExchange(conn *amqp.Connection, name, kind string) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	return ch.ExchangeDeclare(name, kind, true, false, false, false, nil)
+}
+
+func (b *AMQPBroker) DeclareQueue(name string, simpleQueueType SimpleQueueType, args amqp.Table) (amqp.Queue, error) {
+	conn, err := b.connection()
+	if err != nil {
+		return amqp.Queue{}, err
+	}
+	queue, err := declareQueue(conn, name, simpleQueueType, args)
+	if err != nil {
+		return amqp.Queue{}, err
+	}
+	// A server-named queue can't be redeclared under the same name, and
+	// would be gone with its connection anyway.
+	if name == "" {
+		return queue, nil
+	}
+
+	declared := declaredQueue{
+		name:            queue.Name,
+		simpleQueueType: simpleQueueType,
+		args:            args,
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, existing := range b.queues {
+		if existing.name == declared.name {
+			b.queues[i] = declared
+			return queue, nil
+		}
+	}
+	b.queues = append(b.queues, declared)
+	return queue, nil
+}
+
+func declareQueue(conn *amqp.Connection, name string, simpleQueueType SimpleQueueType, args amqp.Table) (amqp.Queue, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return amqp.Queue{}, err
+	}
+	defer channel.Close()
+
+	durable := simpleQueueType == SimpleQueueDurable
+	autoDelete := simpleQueueType == SimpleQueueTransient
+	exclusive := simpleQueueType == SimpleQueueTransient
+
+	return channel.QueueDeclare(
+		name,
+		durable,
+		autoDelete,
+		exclusive,
+		false,
+		args,
+	)
+}
+
+func (b *AMQPBroker) BindQueue(queueName, exchange, key string) error {
+	conn, err := b.connection()
+	if err != nil {
+		return err
+	}
+	err = bindQueue(conn, queueName, exchange, key)
+	if err != nil {
+		return err
+	}
+
+	binding := declaredBinding{
+		queueName: queueName,
+		exchange:  exchange,
+		key:       key,
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// Bindings of queues that aren't redeclared, such as server-named ones,
+	// would only fail with the queue gone after a reconnect.
+	if !b.declaredQueue(queueName) {
+		return nil
+	}
+	for _, existing := range b.bindings {
+		if existing == binding {
+			return nil
+		}
+	}
+	b.bindings = append(b.bindings, binding)
+	return nil
+}
+
+// declaredQueue reports whether queueName is redeclared on reconnect. b.mu
+// must be held.
+func (b *AMQPBroker) declaredQueue(queueName string) bool {
+	for _, queue := range b.queues {
+		if queue.name == queueName {
+			return true
+		}
+	}
+	return false
+}
+
+func bindQueue(conn *amqp.Connection, queueName, exchange, key string) error {
+	channel, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+
+	return channel.QueueBind(
+		queueName,
+		key,
+		exchange,
+		false,
+		nil,
+	)
+}
+
+// Consume starts consuming queueName. The returned consumer survives
+// reconnects: its deliveries channel stays open and is fed from a new AMQP
+// channel each time the connection is restored.
+func (b *AMQPBroker) Consume(queueName string, prefetch int) (Consumer, error) {
+	conn, err := b.connection()
+	if err != nil {
+		return nil, err
+	}
+	ch, msgs, err := startConsuming(conn, queueName, prefetch)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &amqpConsumer{
+		broker:     b,
+		queueName:  queueName,
+		prefetch:   prefetch,
+		deliveries: make(chan amqp.Delivery),
+		done:       make(chan struct{}),
+		ch:         ch,
+	}
+	go c.run(msgs)
+	return c, nil
+}
+
+func startConsuming(conn *amqp.Connection, queueName string, prefetch int) (*amqp.Channel, <-chan amqp.Delivery, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = ch.Qos(prefetch, 0, false)
+	if err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+
+	msgs, err := ch.Consume(
+		queueName,
+		"",
+		false,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		ch.Close()
+		return nil, nil, fmt.Errorf("could not consume messages: %v", err)
+	}
+	return ch, msgs, nil
+}
+
+func (b *AMQPBroker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.closing)
+	conn := b.conn
+	b.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+type amqpConsumer struct {
+	broker     *AMQPBroker
+	queueName  string
+	prefetch   int
+	deliveries chan amqp.Delivery
+	done       chan struct{}
+	cancelOnce sync.Once
+
+	mu sync.Mutex
+	ch *amqp.Channel
+}
+
+func (c *amqpConsumer) Deliveries() <-chan amqp.Delivery {
+	return c.deliveries
+}
+
+func (c *amqpConsumer) run(msgs <-chan amqp.Delivery) {
+	defer close(c.deliveries)
+
+	for {
+		for msg := range msgs {
+			select {
+			case c.deliveries <- msg:
+			case <-c.done:
+				return
+			}
+		}
+
+		// The AMQP channel is gone: either we were cancelled or the
+		// connection dropped and we have to wait for it to come back.
+		for {
+			conn, ok := c.broker.waitConnected(c.done)
+			if !ok {
+				return
+			}
+			ch, newMsgs, err := startConsuming(conn, c.queueName, c.prefetch)
+			if err != nil {
+				c.broker.logger.Warn("could not resume consuming", "queue", c.queueName, "error", err)
+				select {
+				case <-time.After(minReconnectDelay):
+					continue
+				case <-c.done:
+					return
+				}
+			}
+
+			c.mu.Lock()
+			select {
+			case <-c.done:
+				c.mu.Unlock()
+				ch.Close()
+				return
+			default:
+			}
+			c.ch = ch
+			c.mu.Unlock()
+			msgs = newMsgs
+			break
+		}
+	}
+}
+
+func (c *amqpConsumer) Cancel() error {
+	var err error
+	c.cancelOnce.Do(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		close(c.done)
+		err = c.ch.Close()
+		if errors.Is(err, amqp.ErrClosed) {
+			err = nil
+		}
+	})
+	return err
+}
@@ -0,0 +1,123 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Publisher sends messages to an exchange.
+type Publisher interface {
+	Publish(ctx context.Context, exchange, key string, msg amqp.Publishing, opts PublishOptions) error
+}
+
+type PublishOptions struct {
+	// Confirm waits until the broker has taken responsibility for the
+	// message, or until the context passed to Publish expires.
+	Confirm bool
+	// Mandatory makes the broker return the message instead of dropping it
+	// when no queue is bound to receive it; Publish then fails with an
+	// *UnroutableError. Mandatory implies Confirm, since a return can only
+	// be reported once the broker has answered.
+	Mandatory bool
+	// Republish marks a message copied from a delivery to requeue, retry
+	// or dead-letter it. It keeps the delivery's user ID rather than being
+	// stamped with the publisher's.
+	Republish bool
+}
+
+type PublishOption func(*PublishOptions)
+
+func WithConfirm() PublishOption {
+	return func(o *PublishOptions) {
+		o.Confirm = true
+	}
+}
+
+func WithMandatory() PublishOption {
+	return func(o *PublishOptions) {
+		o.Confirm = true
+		o.Mandatory = true
+	}
+}
+
+func newPublishOptions(opts []PublishOption) PublishOptions {
+	var options PublishOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// ErrNacked is returned by a confirmed publish the broker refused.
+var ErrNacked = errors.New("message was nacked by the broker")
+
+// UnroutableError is returned by a mandatory publish that no queue received.
+type UnroutableError struct {
+	Exchange  string
+	Key       string
+	ReplyCode uint16
+	ReplyText string
+}
+
+func (e *UnroutableError) Error() string {
+	return fmt.Sprintf("message to exchange %q with key %q was returned: %d %s", e.Exchange, e.Key, e.ReplyCode, e.ReplyText)
+}
+
+// Subscriber declares queues and consumes deliveries from them.
+type Subscriber interface {
+	// DeclareQueue declares a queue, letting the broker pick a name if name
+	// is empty.
+	DeclareQueue(name string, simpleQueueType SimpleQueueType, args amqp.Table) (amqp.Queue, error)
+	BindQueue(queueName, exchange, key string) error
+	Consume(queueName string, prefetch int) (Consumer, error)
+}
+
+// Consumer is a stream of deliveries from a single queue. The deliveries
+// channel is closed once the consumer is cancelled or the broker goes away.
+type Consumer interface {
+	Deliveries() <-chan amqp.Delivery
+	Cancel() error
+}
+
+// Broker is everything the game needs from a message broker. It is
+// implemented by AMQPBroker for RabbitMQ and by MemoryBroker for tests.
+type Broker interface {
+	Publisher
+	Subscriber
+	DeclareExchange(name, kind string) error
+	Close() error
+}
+
+// DeclareAndBind declares a queue that dead-letters to DeadLetterExchange and
+// binds it to exchange with key.
+func DeclareAndBind(
+	sub Subscriber,
+	exchange,
+	queueName,
+	key string,
+	simpleQueueType SimpleQueueType,
+) (amqp.Queue, error) {
+	queue, err := sub.DeclareQueue(queueName, simpleQueueType, QueueArgs())
+	if err != nil {
+		return amqp.Queue{}, err
+	}
+
+	err = sub.BindQueue(queue.Name, exchange, key)
+	if err != nil {
+		return amqp.Queue{}, err
+	}
+
+	return queue, nil
+}
+
+// QueueArgs are the arguments every game queue is declared with. Declaring
+// the same queue with different arguments is an error, so anything else that
+// declares game queues must use them too.
+func QueueArgs() amqp.Table {
+	return amqp.Table{
+		"x-dead-letter-exchange": DeadLetterExchange,
+	}
+}
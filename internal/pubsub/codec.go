@@ -0,0 +1,140 @@
+package pubsub
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	ContentTypeJSON        = "application/json"
+	ContentTypeGob         = "application/gob"
+	ContentTypeMessagePack = "application/msgpack"
+	ContentTypeProtobuf    = "application/protobuf"
+)
+
+// Codec encodes and decodes message bodies for one content type.
+type Codec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	JSON        Codec = jsonCodec{}
+	Gob         Codec = gobCodec{}
+	MessagePack Codec = msgpackCodec{}
+	// Protobuf only handles values that implement proto.Message.
+	Protobuf Codec = protobufCodec{}
+)
+
+var codecs = struct {
+	mu     sync.RWMutex
+	byType map[string]Codec
+}{
+	byType: map[string]Codec{
+		ContentTypeJSON:        JSON,
+		ContentTypeGob:         Gob,
+		ContentTypeMessagePack: MessagePack,
+		ContentTypeProtobuf:    Protobuf,
+	},
+}
+
+// RegisterCodec makes c available to subscribers for its content type,
+// replacing any codec previously registered for it.
+func RegisterCodec(c Codec) {
+	codecs.mu.Lock()
+	defer codecs.mu.Unlock()
+	codecs.byType[c.ContentType()] = c
+}
+
+// CodecFor returns the codec registered for contentType.
+func CodecFor(contentType string) (Codec, error) {
+	codecs.mu.RLock()
+	defer codecs.mu.RUnlock()
+	c, ok := codecs.byType[contentType]
+	if !ok {
+		return nil, fmt.Errorf("no codec registered for content type %q", contentType)
+	}
+	return c, nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return ContentTypeJSON }
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) ContentType() string { return ContentTypeGob }
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return ContentTypeMessagePack }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return ContentTypeProtobuf }
+
+func (protobufCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal accepts either a message or a pointer to a message pointer, so
+// that Subscribe[*pb.Foo] works: it decodes into a **pb.Foo.
+func (protobufCodec) Unmarshal(data []byte, v any) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && rv.Elem().Kind() == reflect.Pointer {
+		elem := reflect.New(rv.Elem().Type().Elem())
+		if m, ok := elem.Interface().(proto.Message); ok {
+			if err := proto.Unmarshal(data, m); err != nil {
+				return err
+			}
+			rv.Elem().Set(elem)
+			return nil
+		}
+	}
+	return fmt.Errorf("%T is not a proto.Message", v)
+}
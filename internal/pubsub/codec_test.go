@@ -0,0 +1,212 @@
+package pubsub_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type codecPayload struct {
+	Name   string
+	Count  int
+	Tags   []string
+	Nested struct{ OK bool }
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	payload := codecPayload{Name: "alice", Count: 3, Tags: []string{"a", "b"}}
+	payload.Nested.OK = true
+
+	tests := []struct {
+		name        string
+		codec       pubsub.Codec
+		contentType string
+		in          any
+		// out is what to decode into; want is what it should then hold.
+		out  func() any
+		want any
+	}{
+		{
+			name:        "json",
+			codec:       pubsub.JSON,
+			contentType: pubsub.ContentTypeJSON,
+			in:          payload,
+			out:         func() any { return &codecPayload{} },
+			want:        &payload,
+		},
+		{
+			name:        "gob",
+			codec:       pubsub.Gob,
+			contentType: pubsub.ContentTypeGob,
+			in:          payload,
+			out:         func() any { return &codecPayload{} },
+			want:        &payload,
+		},
+		{
+			name:        "msgpack",
+			codec:       pubsub.MessagePack,
+			contentType: pubsub.ContentTypeMessagePack,
+			in:          payload,
+			out:         func() any { return &codecPayload{} },
+			want:        &payload,
+		},
+		{
+			name:        "protobuf into a message",
+			codec:       pubsub.Protobuf,
+			contentType: pubsub.ContentTypeProtobuf,
+			in:          wrapperspb.String("alice"),
+			out:         func() any { return &wrapperspb.StringValue{} },
+			want:        wrapperspb.String("alice"),
+		},
+		{
+			name:        "protobuf into a message pointer",
+			codec:       pubsub.Protobuf,
+			contentType: pubsub.ContentTypeProtobuf,
+			in:          wrapperspb.String("alice"),
+			out:         func() any { return new(*wrapperspb.StringValue) },
+			want:        func() any { m := wrapperspb.String("alice"); return &m }(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.codec.ContentType(); got != tt.contentType {
+				t.Errorf("content type = %q, want %q", got, tt.contentType)
+			}
+			data, err := tt.codec.Marshal(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := tt.out()
+			err = tt.codec.Unmarshal(data, out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !codecEqual(out, tt.want) {
+				t.Errorf("decoded %+v, want %+v", out, tt.want)
+			}
+		})
+	}
+}
+
+func codecEqual(got, want any) bool {
+	if m, ok := want.(proto.Message); ok {
+		g, ok := got.(proto.Message)
+		return ok && proto.Equal(g, m)
+	}
+	if m, ok := want.(**wrapperspb.StringValue); ok {
+		g, ok := got.(**wrapperspb.StringValue)
+		return ok && proto.Equal(*g, *m)
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+func TestProtobufRejectsOtherValues(t *testing.T) {
+	_, err := pubsub.Protobuf.Marshal(codecPayload{})
+	if err == nil {
+		t.Error("marshalled a value that isn't a proto.Message")
+	}
+	err = pubsub.Protobuf.Unmarshal(nil, &codecPayload{})
+	if err == nil {
+		t.Error("unmarshalled into a value that isn't a proto.Message")
+	}
+}
+
+// textCodec stands in for a codec an application registers itself.
+type textCodec struct{}
+
+func (textCodec) ContentType() string { return "text/plain" }
+
+func (textCodec) Marshal(v any) ([]byte, error) {
+	return []byte(v.(string)), nil
+}
+
+func (textCodec) Unmarshal(data []byte, v any) error {
+	*v.(*string) = strings.ToUpper(string(data))
+	return nil
+}
+
+func TestCodecFor(t *testing.T) {
+	pubsub.RegisterCodec(textCodec{})
+	tests := []struct {
+		contentType string
+		want        pubsub.Codec
+	}{
+		{pubsub.ContentTypeJSON, pubsub.JSON},
+		{pubsub.ContentTypeGob, pubsub.Gob},
+		{pubsub.ContentTypeMessagePack, pubsub.MessagePack},
+		{pubsub.ContentTypeProtobuf, pubsub.Protobuf},
+		{"text/plain", textCodec{}},
+		{"application/xml", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			got, err := pubsub.CodecFor(tt.contentType)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %T, want %T", got, tt.want)
+			}
+		})
+	}
+}
+
+// A subscriber decodes each message with the codec its content type names,
+// whichever codec the subscription was written for.
+func TestSubscribeDecodesByContentType(t *testing.T) {
+	b := newBroker(t)
+	deliveries := collect(t, b, "q", ack[codecPayload])
+
+	payload := codecPayload{Name: "alice", Count: 3}
+	for _, codec := range []pubsub.Codec{pubsub.JSON, pubsub.Gob, pubsub.MessagePack} {
+		err := pubsub.Publish(context.Background(), b, codec, "direct", "q", payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := next(t, deliveries)
+		if !reflect.DeepEqual(d.Payload, payload) {
+			t.Errorf("%s: decoded %+v, want %+v", codec.ContentType(), d.Payload, payload)
+		}
+	}
+
+	pubsub.RegisterCodec(textCodec{})
+	texts := collect(t, b, "texts", ack[string])
+	err := pubsub.Publish(context.Background(), b, textCodec{}, "direct", "texts", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := next(t, texts).Payload; got != "HELLO" {
+		t.Errorf("decoded %q with the registered codec, want HELLO", got)
+	}
+}
+
+// A body no codec can decode is dead-lettered rather than handled.
+func TestSubscribeUnknownContentType(t *testing.T) {
+	b := newBroker(t)
+	deliveries := collect(t, b, "q", ack[codecPayload])
+	dead := consume(t, b, "dlq")
+
+	err := b.Publish(context.Background(), "direct", "q", amqp.Publishing{ContentType: "application/xml", Body: []byte("<alice/>")}, pubsub.PublishOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := receive(t, dead)
+	if !strings.Contains(d.Headers[pubsub.HeaderError].(string), "application/xml") {
+		t.Errorf("dead-lettered with %v", d.Headers[pubsub.HeaderError])
+	}
+	none(t, deliveries, 50*time.Millisecond)
+}
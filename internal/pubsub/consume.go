@@ -1,224 +1,279 @@
 package pubsub
 
 import (
-	"bytes"
-	"encoding/gob"
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
+	"hash/fnv"
+	"sync"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
-func DeclareAndBind(
-	conn *amqp.Connection,
+// Subscribe declares and binds queueName, then hands every delivery to
+// handler. Each body is decoded with the codec registered for the delivery's
+// content type, so publishers can switch formats without breaking it.
+func Subscribe[T any](
+	ctx context.Context,
+	broker Broker,
 	exchange,
 	queueName,
 	key string,
 	simpleQueueType SimpleQueueType,
-) (*amqp.Channel, amqp.Queue, error) {
-	channel, err := conn.Channel()
-	if err != nil {
-		return nil, amqp.Queue{}, err
-	}
-
-	durable := simpleQueueType == SimpleQueueDurable
-	autoDelete := simpleQueueType == SimpleQueueTransient
-	exclusive := simpleQueueType == SimpleQueueTransient
-
-	queue, err := channel.QueueDeclare(
+	handler func(T) AckType,
+	opts ...SubscribeOption,
+) (*Subscription, error) {
+	return SubscribeDelivery(
+		ctx,
+		broker,
+		exchange,
 		queueName,
-		durable,
-		autoDelete,
-		exclusive,
-		false,
-		amqp.Table{
-			"x-dead-letter-exchange": "peril_dlx",
-		},
-	)
-	if err != nil {
-		return nil, amqp.Queue{}, err
-	}
-
-	err = channel.QueueBind(
-		queue.Name,
 		key,
-		exchange,
-		false,
-		nil,
+		simpleQueueType,
+		func(d Delivery[T]) AckType {
+			return handler(d.Payload)
+		},
+		opts...,
 	)
-	if err != nil {
-		return nil, amqp.Queue{}, err
-	}
-
-	return channel, queue, nil
 }
 
-func SubscribeJSON[T any](
-	conn *amqp.Connection,
+// SubscribeDelivery is Subscribe for handlers that need the envelope of each
+// message, or want messages they publish to record it as their cause.
+func SubscribeDelivery[T any](
+	ctx context.Context,
+	broker Broker,
 	exchange,
 	queueName,
 	key string,
 	simpleQueueType SimpleQueueType,
-	handler func(T) AckType,
-) error {
-	err := subscribe(
-		conn,
+	handler Handler[T],
+	opts ...SubscribeOption,
+) (*Subscription, error) {
+	return subscribe(
+		ctx,
+		broker,
 		exchange,
 		queueName,
 		key,
 		simpleQueueType,
 		handler,
-		consumeJSONMessages,
+		newSubscribeOptions(opts),
 	)
-	if err != nil {
-		return err
-	}
-	return nil
 }
 
+// SubscribeJSON is Subscribe for queues fed with JSON. It decodes any
+// registered content type.
+func SubscribeJSON[T any](
+	ctx context.Context,
+	broker Broker,
+	exchange,
+	queueName,
+	key string,
+	simpleQueueType SimpleQueueType,
+	handler func(T) AckType,
+	opts ...SubscribeOption,
+) (*Subscription, error) {
+	return Subscribe(ctx, broker, exchange, queueName, key, simpleQueueType, handler, opts...)
+}
+
+// SubscribeGob is Subscribe for queues fed with gob. It decodes any
+// registered content type.
 func SubscribeGob[T any](
-	conn *amqp.Connection,
+	ctx context.Context,
+	broker Broker,
 	exchange,
 	queueName,
 	key string,
 	simpleQueueType SimpleQueueType,
 	handler func(T) AckType,
-) error {
-	err := subscribe(
-		conn,
-		exchange,
-		queueName,
-		key,
-		simpleQueueType,
-		handler,
-		consumeGobMessages,
-	)
-	if err != nil {
-		return err
-	}
-	return nil
+	opts ...SubscribeOption,
+) (*Subscription, error) {
+	return Subscribe(ctx, broker, exchange, queueName, key, simpleQueueType, handler, opts...)
 }
 
 func subscribe[T any](
-	conn *amqp.Connection,
+	ctx context.Context,
+	broker Broker,
 	exchange,
 	queueName,
 	key string,
 	simpleQueueType SimpleQueueType,
-	handler func(T) AckType,
-	messageConsumer func(<-chan amqp.Delivery, func(T) AckType) error,
-) error {
-	ch, q, err := DeclareAndBind(
-		conn,
+	handler Handler[T],
+	options subscribeOptions,
+) (*Subscription, error) {
+	wrapped, err := chainOptions(handler, options.middleware)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := DeclareAndBind(
+		broker,
 		exchange,
 		queueName,
 		key,
 		simpleQueueType,
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = ch.Qos(10, 0, true)
+	consumer, err := broker.Consume(q.Name, options.prefetch)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	msgs, err := ch.Consume(
-		q.Name,
-		"",
-		false,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		return fmt.Errorf("could not consume messages: %v", err)
+	settler := &settler{
+		broker:          broker,
+		queueName:       q.Name,
+		simpleQueueType: simpleQueueType,
+		policy:          options.failurePolicy,
+		retryPolicy:     options.retryPolicy,
+		retryQueues:     map[time.Duration]string{},
+		logger:          LoggerFromContext(ctx).With("queue", q.Name),
 	}
-
-	errCh := make(chan error, 1)
+	subscription := newSubscription(q.Name, consumer)
 	go func() {
-		defer ch.Close()
-		errCh <- messageConsumer(msgs, handler)
+		defer close(subscription.done)
+		defer consumer.Cancel()
+		// Handlers keep running while a cancelled subscription drains, so
+		// they get ctx's values but not its cancellation.
+		handlerCtx := context.WithoutCancel(ctx)
+		subscription.err = consumeMessages(handlerCtx, key, consumer.Deliveries(), subscription.stop, settler, wrapped, options)
+		if subscription.err != nil {
+			settler.logger.Error("consumer stopped", "error", subscription.err)
+		}
 	}()
 	go func() {
-		if err := <-errCh; err != nil {
-			log.Fatalf("consumer terminated with fatal error: %v", err)
+		select {
+		case <-ctx.Done():
+			subscription.Drain(context.Background())
+		case <-subscription.done:
 		}
 	}()
 
-	return nil
+	return subscription, nil
 }
 
-func consumeJSONMessages[T any](messages <-chan amqp.Delivery, handler func(T) AckType) error {
-	for message := range messages {
-		var payload T
-		if err := json.Unmarshal(message.Body, &payload); err != nil {
-			if nackErr := message.Nack(false, true); nackErr != nil {
-				log.Printf("failed to nack message: %v", nackErr)
+// consumeMessages runs the subscription until stop is closed or the
+// deliveries run out. With more than one worker, deliveries are handled
+// concurrently; if an ordering key is set, deliveries that share a key always
+// go to the same worker and so keep their relative order.
+func consumeMessages[T any](ctx context.Context, route string, messages <-chan amqp.Delivery, stop <-chan struct{}, settler *settler, handler Handler[T], options subscribeOptions) error {
+	if options.workers <= 1 {
+		for {
+			message, ok := nextMessage(messages, stop)
+			if !ok {
+				return nil
 			}
-			continue
-		}
-		acktype := handler(payload)
-		err := handleMessageAck(message, acktype)
-		if err != nil {
-			return err
+			processMessage(ctx, route, message, settler, handler)
 		}
 	}
-	return nil
-}
 
-func consumeGobMessages[T any](messages <-chan amqp.Delivery, handler func(T) AckType) error {
-	for message := range messages {
-		buffer := bytes.NewBuffer(message.Body)
-		var payload T
-		decoder := gob.NewDecoder(buffer)
-		err := decoder.Decode(&payload)
-		if err != nil {
-			if nackErr := message.Nack(false, true); nackErr != nil {
-				log.Printf("failed to nack message: %v", nackErr)
-			}
-			continue
-		}
-		acktype := handler(payload)
-		err = handleMessageAck(message, acktype)
-		if err != nil {
-			return err
+	queues := make([]chan amqp.Delivery, options.workers)
+	shared := make(chan amqp.Delivery)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = shared
+		if options.orderingKey != nil {
+			queues[i] = make(chan amqp.Delivery)
 		}
 	}
-	return nil
-}
-
-func handleMessageAck(message amqp.Delivery, acktype AckType) error {
-	switch acktype {
-	case Ack:
-		err := message.Ack(false)
-		if err != nil {
-			return handleAckTypeError(acktype, err)
+	for i := 0; i < options.workers; i++ {
+		work := queues[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for message := range work {
+				processMessage(ctx, route, message, settler, handler)
+			}
+		}()
+	}
+	defer func() {
+		closed := map[chan amqp.Delivery]bool{}
+		for _, queue := range queues {
+			if !closed[queue] {
+				close(queue)
+				closed[queue] = true
+			}
 		}
-	case NackRequeue:
-		err := message.Nack(false, true)
-		if err != nil {
-			return handleAckTypeError(acktype, err)
+		wg.Wait()
+	}()
+
+	for {
+		message, ok := nextMessage(messages, stop)
+		if !ok {
+			return nil
 		}
-	case NackDiscard:
-		err := message.Nack(false, false)
-		if err != nil {
-			return handleAckTypeError(acktype, err)
+		work := shared
+		if options.orderingKey != nil {
+			h := fnv.New32a()
+			h.Write([]byte(options.orderingKey(message)))
+			work = queues[h.Sum32()%uint32(len(queues))]
 		}
-	default:
-		log.Printf("unknown AckType: %v; discarding message", acktype)
-		err := message.Nack(false, false)
-		if err != nil {
-			return handleAckTypeError(acktype, err)
+		select {
+		case work <- message:
+		case <-stop:
+			// Never handed to a worker; the broker requeues it once the
+			// consumer is cancelled.
+			return nil
 		}
 	}
-	return nil
 }
 
-func handleAckTypeError(ackType AckType, err error) error {
-	log.Printf("failed to process AckType %v: %v", ackType, err)
-	return err
+func processMessage[T any](ctx context.Context, route string, message amqp.Delivery, settler *settler, handler Handler[T]) {
+	start := time.Now()
+	observeDelivery(route, message, start)
+	ctx, span := startConsumerSpan(ctx, route, message)
+	defer span.End()
+
+	payload, err := decode[T](message)
+	if err != nil {
+		decodeFailuresTotal.WithLabelValues(route).Inc()
+		err = fmt.Errorf("could not decode %q body: %v", message.ContentType, err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		// Redelivering a body we cannot decode would fail the same way
+		// forever, so it goes straight to the dead-letter exchange.
+		_ = settler.deadLetter(message, err)
+		return
+	}
+	envelope := envelopeOf(message)
+	acktype := handler(Delivery[T]{
+		Payload:  payload,
+		Envelope: envelope,
+		ctx:      contextWithEnvelope(ctx, envelope),
+	})
+	observeHandled(route, start, acktype)
+	span.SetAttributes(attribute.String("peril.ack", acktype.String()))
+	// A failed ack means the channel went away with the message still
+	// unacknowledged; the broker will redeliver it, so keep consuming.
+	_ = settler.settle(message, acktype)
+}
+
+func decode[T any](message amqp.Delivery) (T, error) {
+	var payload T
+	codec, err := CodecFor(message.ContentType)
+	if err != nil {
+		return payload, err
+	}
+	err = codec.Unmarshal(message.Body, &payload)
+	return payload, err
+}
+
+// nextMessage returns the next delivery, or false once stop is closed or the
+// deliveries channel is exhausted. A stop request wins over a ready delivery.
+func nextMessage(messages <-chan amqp.Delivery, stop <-chan struct{}) (amqp.Delivery, bool) {
+	select {
+	case <-stop:
+		return amqp.Delivery{}, false
+	default:
+	}
+	select {
+	case <-stop:
+		return amqp.Delivery{}, false
+	case message, ok := <-messages:
+		return message, ok
+	}
 }
@@ -0,0 +1,101 @@
+package pubsub_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestWorkersRunConcurrently(t *testing.T) {
+	const workers = 3
+	b := newBroker(t)
+	// Every handler waits until all workers are busy at once, which never
+	// happens if deliveries are handled one at a time.
+	var busy sync.WaitGroup
+	busy.Add(workers)
+	deliveries := collect(t, b, "q", func(pubsub.Delivery[int]) pubsub.AckType {
+		busy.Done()
+		busy.Wait()
+		return pubsub.Ack
+	}, pubsub.WithWorkers(workers))
+
+	for i := 0; i < workers; i++ {
+		if err := pubsub.PublishJSON(context.Background(), b, "direct", "q", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < workers; i++ {
+		next(t, deliveries)
+	}
+}
+
+type keyed struct {
+	Key string
+	N   int
+}
+
+func TestOrderingKey(t *testing.T) {
+	const perKey = 50
+	keys := []string{"alice", "bob", "carol", "dave", "erin"}
+	b := newBroker(t)
+
+	var mu sync.Mutex
+	seen := map[string][]int{}
+	deliveries := collect(t, b, "q", func(d pubsub.Delivery[keyed]) pubsub.AckType {
+		// Give other workers a chance to overtake this one.
+		time.Sleep(time.Duration(d.Payload.N%3) * time.Millisecond)
+		mu.Lock()
+		seen[d.Payload.Key] = append(seen[d.Payload.Key], d.Payload.N)
+		mu.Unlock()
+		return pubsub.Ack
+	},
+		pubsub.WithWorkers(4),
+		pubsub.WithPrefetch(100),
+		pubsub.WithOrderingKey(func(d amqp.Delivery) string {
+			key, _ := d.Headers["key"].(string)
+			return key
+		}),
+	)
+
+	for n := 0; n < perKey; n++ {
+		for _, key := range keys {
+			body, err := json.Marshal(keyed{Key: key, N: n})
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := amqp.Publishing{
+				ContentType: pubsub.JSON.ContentType(),
+				Headers:     amqp.Table{"key": key},
+				Body:        body,
+			}
+			if err := b.Publish(context.Background(), "direct", "q", msg, pubsub.PublishOptions{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for i := 0; i < perKey*len(keys); i++ {
+		next(t, deliveries)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range keys {
+		got := seen[key]
+		if len(got) != perKey {
+			t.Errorf("%s: handled %d messages, want %d", key, len(got), perKey)
+			continue
+		}
+		for i, n := range got {
+			if n != i {
+				t.Errorf("%s: handled out of order: %s", key, fmt.Sprint(got))
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package pubsub
+
+import (
+	"container/list"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DedupStore remembers the IDs of messages that have been processed.
+type DedupStore interface {
+	Seen(id string) (bool, error)
+	MarkSeen(id string) error
+}
+
+// Idempotent skips deliveries whose message ID is already in store, acking
+// them without calling the handler. A message is remembered once its handler
+// settles it for good, with Ack or NackDiscard; messages handed back for
+// another try are not.
+func Idempotent[T any](store DedupStore) Middleware[T] {
+	var mu sync.Mutex
+	inFlight := map[string]bool{}
+
+	return func(next Handler[T]) Handler[T] {
+		return func(d Delivery[T]) AckType {
+			id := d.Envelope.MessageID
+			if id == "" {
+				return next(d)
+			}
+
+			// Concurrent workers may hold two copies of the same message;
+			// only one of them gets to run the handler.
+			mu.Lock()
+			if inFlight[id] {
+				mu.Unlock()
+				return RetryAfter
+			}
+			inFlight[id] = true
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				delete(inFlight, id)
+				mu.Unlock()
+			}()
+
+			logger := LoggerFromContext(d.Context())
+			seen, err := store.Seen(id)
+			if err != nil {
+				logger.Error("could not check message", "message_id", id, "error", err)
+			}
+			if seen {
+				logger.Info("skipping already processed message", "message_id", id)
+				return Ack
+			}
+
+			acktype := next(d)
+			if acktype == Ack || acktype == NackDiscard {
+				if err := store.MarkSeen(id); err != nil {
+					logger.Error("could not remember message", "message_id", id, "error", err)
+				}
+			}
+			return acktype
+		}
+	}
+}
+
+// MemoryDedupStore keeps the most recently processed IDs in memory, forgetting
+// the oldest once it holds capacity of them.
+type MemoryDedupStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+func NewMemoryDedupStore(capacity int) *MemoryDedupStore {
+	return &MemoryDedupStore{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (s *MemoryDedupStore) Seen(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[id]
+	if ok {
+		s.order.MoveToFront(e)
+	}
+	return ok, nil
+}
+
+func (s *MemoryDedupStore) MarkSeen(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[id]; ok {
+		s.order.MoveToFront(e)
+		return nil
+	}
+	s.entries[id] = s.order.PushFront(id)
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(string))
+	}
+	return nil
+}
+
+var dedupBucket = []byte("processed")
+
+// BoltDedupStore keeps processed IDs in a BoltDB file, so they survive a
+// restart.
+type BoltDedupStore struct {
+	db *bolt.DB
+}
+
+func OpenBoltDedupStore(path string) (*BoltDedupStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(dedupBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltDedupStore{db: db}, nil
+}
+
+func (s *BoltDedupStore) Seen(id string) (bool, error) {
+	seen := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		seen = tx.Bucket(dedupBucket).Get([]byte(id)) != nil
+		return nil
+	})
+	return seen, err
+}
+
+func (s *BoltDedupStore) MarkSeen(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var at [8]byte
+		binary.BigEndian.PutUint64(at[:], uint64(time.Now().Unix()))
+		return tx.Bucket(dedupBucket).Put([]byte(id), at[:])
+	})
+}
+
+// Prune forgets IDs processed before cutoff.
+func (s *BoltDedupStore) Prune(cutoff time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(dedupBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if len(v) == 8 && int64(binary.BigEndian.Uint64(v)) < cutoff.Unix() {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltDedupStore) Close() error {
+	return s.db.Close()
+}
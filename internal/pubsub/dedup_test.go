@@ -0,0 +1,116 @@
+package pubsub_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+)
+
+func TestMemoryDedupStoreEviction(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		// ops marks IDs as seen, or looks them up if prefixed with "?".
+		ops     []string
+		seen    []string
+		notSeen []string
+	}{
+		{
+			name:     "keeps up to capacity",
+			capacity: 2,
+			ops:      []string{"a", "b"},
+			seen:     []string{"a", "b"},
+		},
+		{
+			name:     "evicts the oldest",
+			capacity: 2,
+			ops:      []string{"a", "b", "c"},
+			seen:     []string{"b", "c"},
+			notSeen:  []string{"a"},
+		},
+		{
+			name:     "marking again refreshes",
+			capacity: 2,
+			ops:      []string{"a", "b", "a", "c"},
+			seen:     []string{"a", "c"},
+			notSeen:  []string{"b"},
+		},
+		{
+			name:     "a lookup refreshes",
+			capacity: 2,
+			ops:      []string{"a", "b", "?a", "c"},
+			seen:     []string{"a", "c"},
+			notSeen:  []string{"b"},
+		},
+		{
+			name:     "capacity of one",
+			capacity: 1,
+			ops:      []string{"a", "b"},
+			seen:     []string{"b"},
+			notSeen:  []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := pubsub.NewMemoryDedupStore(tt.capacity)
+			for _, op := range tt.ops {
+				if op[0] == '?' {
+					s.Seen(op[1:])
+					continue
+				}
+				if err := s.MarkSeen(op); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, id := range tt.seen {
+				if seen, _ := s.Seen(id); !seen {
+					t.Errorf("%s was forgotten", id)
+				}
+			}
+			for _, id := range tt.notSeen {
+				if seen, _ := s.Seen(id); seen {
+					t.Errorf("%s was not evicted", id)
+				}
+			}
+		})
+	}
+}
+
+func TestBoltDedupStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.db")
+	s, err := pubsub.OpenBoltDedupStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.MarkSeen("order-1"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err = pubsub.OpenBoltDedupStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if seen, err := s.Seen("order-1"); err != nil || !seen {
+		t.Errorf("Seen(order-1) after reopening = %v, %v; want true", seen, err)
+	}
+	if seen, _ := s.Seen("order-2"); seen {
+		t.Error("order-2 was never marked but is seen")
+	}
+
+	if err := s.Prune(time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if seen, _ := s.Seen("order-1"); !seen {
+		t.Error("pruning older IDs forgot a recent one")
+	}
+	if err := s.Prune(time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if seen, _ := s.Seen("order-1"); seen {
+		t.Error("order-1 was not pruned")
+	}
+}
@@ -0,0 +1,150 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	HeaderSchemaVersion = "x-peril-schema-version"
+	HeaderCorrelationID = "x-peril-correlation-id"
+	HeaderCausationID   = "x-peril-causation-id"
+)
+
+// Envelope is the metadata every published message carries next to its
+// payload.
+type Envelope struct {
+	MessageID string
+	Timestamp time.Time
+	// Sender identifies the process that published the message. Publishers
+	// name themselves, so it can't be trusted.
+	Sender string
+	// UserID is the broker user the publisher logged in as, if it said. The
+	// broker checks it, unlike Sender.
+	UserID string
+	// Type is the Go type of the payload.
+	Type          string
+	SchemaVersion int
+	// CorrelationID is shared by every message caused, directly or not, by
+	// the same original message.
+	CorrelationID string
+	// CausationID is the MessageID of the message whose handler published
+	// this one.
+	CausationID string
+	// ReplyTo and RequestID are set on requests sent with Request.
+	ReplyTo   string
+	RequestID string
+
+	Exchange    string
+	RoutingKey  string
+	Redelivered bool
+	Headers     amqp.Table
+}
+
+// Versioned payloads report their schema version. Payloads that don't are
+// version 1.
+type Versioned interface {
+	SchemaVersion() int
+}
+
+// Delivery is a decoded message together with its envelope.
+type Delivery[T any] struct {
+	Payload  T
+	Envelope Envelope
+	ctx      context.Context
+}
+
+// Context carries the envelope of this delivery: messages published with it
+// are recorded as caused by this one.
+func (d Delivery[T]) Context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+type senderKey struct{}
+type envelopeKey struct{}
+
+// ContextWithSender names the publisher of every message published with ctx.
+func ContextWithSender(ctx context.Context, sender string) context.Context {
+	return context.WithValue(ctx, senderKey{}, sender)
+}
+
+func senderFromContext(ctx context.Context) string {
+	sender, _ := ctx.Value(senderKey{}).(string)
+	return sender
+}
+
+// EnvelopeFromContext returns the envelope of the message being handled.
+func EnvelopeFromContext(ctx context.Context) (Envelope, bool) {
+	env, ok := ctx.Value(envelopeKey{}).(Envelope)
+	return env, ok
+}
+
+func contextWithEnvelope(ctx context.Context, env Envelope) context.Context {
+	return context.WithValue(ctx, envelopeKey{}, env)
+}
+
+// stamp fills in the envelope of an outgoing message.
+func stamp(ctx context.Context, msg *amqp.Publishing, val any) {
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+	msg.MessageId = newMessageID()
+	msg.Timestamp = time.Now()
+	msg.AppId = senderFromContext(ctx)
+	msg.Type = fmt.Sprintf("%T", val)
+
+	version := 1
+	if v, ok := val.(Versioned); ok {
+		version = v.SchemaVersion()
+	}
+	msg.Headers[HeaderSchemaVersion] = int64(version)
+
+	correlationID := msg.MessageId
+	if parent, ok := EnvelopeFromContext(ctx); ok {
+		correlationID = parent.CorrelationID
+		if correlationID == "" {
+			correlationID = parent.MessageID
+		}
+		msg.Headers[HeaderCausationID] = parent.MessageID
+	}
+	msg.Headers[HeaderCorrelationID] = correlationID
+}
+
+func envelopeOf(message amqp.Delivery) Envelope {
+	correlationID, _ := message.Headers[HeaderCorrelationID].(string)
+	causationID, _ := message.Headers[HeaderCausationID].(string)
+	version := headerInt(message.Headers, HeaderSchemaVersion)
+	if version == 0 {
+		version = 1
+	}
+	return Envelope{
+		MessageID:     message.MessageId,
+		Timestamp:     message.Timestamp,
+		Sender:        message.AppId,
+		UserID:        message.UserId,
+		Type:          message.Type,
+		SchemaVersion: version,
+		CorrelationID: correlationID,
+		CausationID:   causationID,
+		ReplyTo:       message.ReplyTo,
+		RequestID:     message.CorrelationId,
+		Exchange:      message.Exchange,
+		RoutingKey:    message.RoutingKey,
+		Redelivered:   message.Redelivered,
+		Headers:       message.Headers,
+	}
+}
+
+func newMessageID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
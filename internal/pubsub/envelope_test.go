@@ -0,0 +1,121 @@
+package pubsub_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+)
+
+type versioned struct{}
+
+func (versioned) SchemaVersion() int { return 3 }
+
+func TestEnvelopeStamp(t *testing.T) {
+	b := newBroker(t)
+	plain := collect(t, b, "strings", ack[string])
+	versions := collect(t, b, "versions", ack[versioned])
+
+	ctx := pubsub.ContextWithSender(context.Background(), "alice")
+	for i := 0; i < 2; i++ {
+		if err := pubsub.PublishJSON(ctx, b, "direct", "strings", "order"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pubsub.PublishJSON(context.Background(), b, "direct", "versions", versioned{}); err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := next(t, plain), next(t, plain)
+	env := first.Envelope
+	if env.MessageID == "" {
+		t.Error("no MessageID")
+	}
+	if env.MessageID == second.Envelope.MessageID {
+		t.Errorf("two messages share MessageID %s", env.MessageID)
+	}
+	if env.Timestamp.IsZero() {
+		t.Error("no Timestamp")
+	}
+	if env.Sender != "alice" {
+		t.Errorf("Sender = %q, want alice", env.Sender)
+	}
+	if env.Type != "string" {
+		t.Errorf("Type = %q, want string", env.Type)
+	}
+	if env.SchemaVersion != 1 {
+		t.Errorf("SchemaVersion = %d, want 1", env.SchemaVersion)
+	}
+	// A message nothing caused starts its own correlation.
+	if env.CorrelationID != env.MessageID {
+		t.Errorf("CorrelationID = %q, want its own MessageID %q", env.CorrelationID, env.MessageID)
+	}
+	if env.CausationID != "" {
+		t.Errorf("CausationID = %q, want none", env.CausationID)
+	}
+
+	env = next(t, versions).Envelope
+	if env.SchemaVersion != 3 {
+		t.Errorf("SchemaVersion = %d, want 3", env.SchemaVersion)
+	}
+	if env.Sender != "" {
+		t.Errorf("Sender = %q, want none", env.Sender)
+	}
+}
+
+func TestEnvelopeCausation(t *testing.T) {
+	b := newBroker(t)
+	// Each hop republishes what it got to the next queue, with the
+	// delivery's context, until the message reaches "done".
+	hop := func(to string) func(pubsub.Delivery[string]) pubsub.AckType {
+		return func(d pubsub.Delivery[string]) pubsub.AckType {
+			if err := pubsub.PublishJSON(d.Context(), b, "direct", to, d.Payload); err != nil {
+				t.Error(err)
+			}
+			return pubsub.Ack
+		}
+	}
+	first := collect(t, b, "first", hop("second"))
+	second := collect(t, b, "second", hop("done"))
+	done := collect(t, b, "done", ack[string])
+
+	if err := pubsub.PublishJSON(context.Background(), b, "direct", "first", "order"); err != nil {
+		t.Fatal(err)
+	}
+
+	root, middle, last := next(t, first).Envelope, next(t, second).Envelope, next(t, done).Envelope
+	if middle.CausationID != root.MessageID {
+		t.Errorf("second hop CausationID = %q, want %q", middle.CausationID, root.MessageID)
+	}
+	if last.CausationID != middle.MessageID {
+		t.Errorf("last hop CausationID = %q, want %q", last.CausationID, middle.MessageID)
+	}
+	for _, env := range []pubsub.Envelope{middle, last} {
+		if env.CorrelationID != root.MessageID {
+			t.Errorf("CorrelationID = %q, want the first message's %q", env.CorrelationID, root.MessageID)
+		}
+	}
+	if root.MessageID == middle.MessageID || middle.MessageID == last.MessageID {
+		t.Error("republished messages reuse a MessageID")
+	}
+}
+
+func TestEnvelopeFromContext(t *testing.T) {
+	b := newBroker(t)
+	deliveries := collect(t, b, "q", ack[string])
+	if err := pubsub.PublishJSON(context.Background(), b, "direct", "q", "order"); err != nil {
+		t.Fatal(err)
+	}
+
+	d := next(t, deliveries)
+	env, ok := pubsub.EnvelopeFromContext(d.Context())
+	if !ok {
+		t.Fatal("delivery context carries no envelope")
+	}
+	if env.MessageID != d.Envelope.MessageID {
+		t.Errorf("context envelope MessageID = %q, want %q", env.MessageID, d.Envelope.MessageID)
+	}
+	if _, ok := pubsub.EnvelopeFromContext(context.Background()); ok {
+		t.Error("background context carries an envelope")
+	}
+}
@@ -0,0 +1,3 @@
+package pubsub
+
+var TopicMatches = topicMatches
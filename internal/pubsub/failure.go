@@ -0,0 +1,195 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const DeadLetterExchange = "peril_dlx"
+
+const (
+	// HeaderError records why a message was dead-lettered.
+	HeaderError = "x-peril-error"
+	// HeaderQueue records the queue a dead-lettered message was taken from.
+	HeaderQueue = "x-peril-queue"
+	// HeaderRedeliveries counts how many times a message has been requeued.
+	HeaderRedeliveries = "x-peril-redeliveries"
+)
+
+// FailurePolicy decides what happens to messages that cannot be processed.
+type FailurePolicy struct {
+	// MaxRedeliveries caps how many times a message handed back with
+	// NackRequeue is redelivered before it is dead-lettered. Zero leaves
+	// requeueing to the broker, without a cap.
+	MaxRedeliveries int
+	// DeadLetterExchange receives messages that cannot be decoded or that
+	// ran out of redeliveries, with HeaderError explaining why.
+	DeadLetterExchange string
+}
+
+var DefaultFailurePolicy = FailurePolicy{
+	MaxRedeliveries:    10,
+	DeadLetterExchange: DeadLetterExchange,
+}
+
+// settler acknowledges deliveries from one queue according to a handler's
+// AckType and the subscription's FailurePolicy.
+type settler struct {
+	broker          Broker
+	queueName       string
+	simpleQueueType SimpleQueueType
+	policy          FailurePolicy
+	retryPolicy     RetryPolicy
+	logger          *slog.Logger
+
+	mu          sync.Mutex
+	retryQueues map[time.Duration]string
+}
+
+func (s *settler) settle(message amqp.Delivery, acktype AckType) error {
+	switch acktype {
+	case Ack:
+		err := message.Ack(false)
+		if err != nil {
+			return s.ackTypeError(acktype, err)
+		}
+	case NackRequeue:
+		err := s.requeue(message)
+		if err != nil {
+			return s.ackTypeError(acktype, err)
+		}
+	case RetryAfter:
+		err := s.retry(message)
+		if err != nil {
+			return s.ackTypeError(acktype, err)
+		}
+	case NackDiscard:
+		err := message.Nack(false, false)
+		if err != nil {
+			return s.ackTypeError(acktype, err)
+		}
+	default:
+		s.logger.Warn("unknown AckType; discarding message", "ack", acktype)
+		err := message.Nack(false, false)
+		if err != nil {
+			return s.ackTypeError(acktype, err)
+		}
+	}
+	return nil
+}
+
+func (s *settler) ackTypeError(ackType AckType, err error) error {
+	s.logger.Error("failed to process AckType", "ack", ackType, "error", err)
+	return err
+}
+
+// requeue puts the message back on its queue with its redelivery count
+// bumped, or dead-letters it once the count reaches the policy's cap.
+func (s *settler) requeue(message amqp.Delivery) error {
+	if s.policy.MaxRedeliveries <= 0 {
+		return message.Nack(false, true)
+	}
+
+	count := redeliveryCount(message)
+	if count >= s.policy.MaxRedeliveries {
+		return s.deadLetter(message, fmt.Errorf("gave up after %d redeliveries", count))
+	}
+
+	msg := publishingFromDelivery(message)
+	msg.Headers[HeaderRedeliveries] = int64(count + 1)
+	err := s.broker.Publish(context.Background(), "", s.queueName, msg, PublishOptions{Republish: true})
+	if err != nil {
+		s.logger.Error("could not requeue message", "error", err)
+		return message.Nack(false, true)
+	}
+	return message.Ack(false)
+}
+
+// deadLetter moves the message to the dead-letter exchange with cause
+// recorded in its headers. If that publish fails the message is rejected
+// instead, which still dead-letters it through the queue's
+// x-dead-letter-exchange, only without the explanation.
+func (s *settler) deadLetter(message amqp.Delivery, cause error) error {
+	s.logger.Warn("dead-lettering message", "message_id", message.MessageId, "cause", cause)
+
+	msg := publishingFromDelivery(message)
+	msg.Headers[HeaderError] = cause.Error()
+	msg.Headers[HeaderQueue] = s.queueName
+	err := s.broker.Publish(context.Background(), s.policy.DeadLetterExchange, message.RoutingKey, msg, PublishOptions{Republish: true})
+	if err != nil {
+		s.logger.Error("could not publish to dead-letter exchange", "exchange", s.policy.DeadLetterExchange, "error", err)
+		return message.Nack(false, false)
+	}
+	return message.Ack(false)
+}
+
+// redeliveryCount is the number of times a message has already been handed
+// back, taken from whichever source knows: our own header, the quorum queue
+// x-delivery-count header, or the broker's x-death records.
+func redeliveryCount(message amqp.Delivery) int {
+	count := headerInt(message.Headers, HeaderRedeliveries)
+	if n := headerInt(message.Headers, "x-delivery-count"); n > count {
+		count = n
+	}
+
+	// Only rejections count: expiries come from retry queues, which
+	// RetryPolicy keeps its own tally of.
+	deaths, _ := message.Headers["x-death"].([]interface{})
+	deathCount := 0
+	for _, entry := range deaths {
+		if table, ok := entry.(amqp.Table); ok && table["reason"] == "rejected" {
+			deathCount += headerInt(table, "count")
+		}
+	}
+	if deathCount > count {
+		count = deathCount
+	}
+	return count
+}
+
+func headerInt(headers amqp.Table, key string) int {
+	switch v := headers[key].(type) {
+	case int:
+		return v
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case uint8:
+		return int(v)
+	case uint16:
+		return int(v)
+	case uint32:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+func publishingFromDelivery(d amqp.Delivery) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:         copyTable(d.Headers),
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		Expiration:      d.Expiration,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		UserId:          d.UserId,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+}
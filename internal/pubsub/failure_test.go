@@ -0,0 +1,150 @@
+package pubsub_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestDecodeFailureDeadLettered(t *testing.T) {
+	b := newBroker(t)
+	deliveries := collect(t, b, "q", ack[codecPayload])
+	dead := consume(t, b, "dlq")
+
+	body := `{"Name": 42}`
+	msg := amqp.Publishing{ContentType: pubsub.JSON.ContentType(), Body: []byte(body)}
+	if err := b.Publish(context.Background(), "direct", "q", msg, pubsub.PublishOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	d := receive(t, dead)
+	if string(d.Body) != body {
+		t.Errorf("dead-lettered %q, want %q", d.Body, body)
+	}
+	if cause, _ := d.Headers[pubsub.HeaderError].(string); !strings.Contains(cause, "could not decode") {
+		t.Errorf("%s = %q, want the decode error", pubsub.HeaderError, cause)
+	}
+	if d.Headers[pubsub.HeaderQueue] != "q" {
+		t.Errorf("%s = %v, want q", pubsub.HeaderQueue, d.Headers[pubsub.HeaderQueue])
+	}
+	// Undecodable bodies never reach the handler, and aren't redelivered.
+	none(t, deliveries, 50*time.Millisecond)
+}
+
+func TestRedeliveryCap(t *testing.T) {
+	tests := []struct {
+		name            string
+		maxRedeliveries int
+		// requeues is how many times the handler hands the message back
+		// before acking it.
+		requeues       int
+		wantHandled    int
+		wantDeadLetter bool
+	}{
+		{name: "acked before the cap", maxRedeliveries: 3, requeues: 2, wantHandled: 3},
+		{name: "acked on the last redelivery", maxRedeliveries: 3, requeues: 3, wantHandled: 4},
+		{name: "dead-lettered past the cap", maxRedeliveries: 3, requeues: 10, wantHandled: 4, wantDeadLetter: true},
+		{name: "no cap", maxRedeliveries: 0, requeues: 15, wantHandled: 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBroker(t)
+			handled := 0
+			deliveries := collect(t, b, "q", func(pubsub.Delivery[string]) pubsub.AckType {
+				handled++
+				if handled <= tt.requeues {
+					return pubsub.NackRequeue
+				}
+				return pubsub.Ack
+			}, pubsub.WithFailurePolicy(pubsub.FailurePolicy{
+				MaxRedeliveries:    tt.maxRedeliveries,
+				DeadLetterExchange: pubsub.DeadLetterExchange,
+			}))
+			dead := consume(t, b, "dlq")
+
+			if err := pubsub.PublishJSON(context.Background(), b, "direct", "q", "order"); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tt.wantHandled; i++ {
+				next(t, deliveries)
+			}
+			none(t, deliveries, 50*time.Millisecond)
+
+			if !tt.wantDeadLetter {
+				select {
+				case d := <-dead.Deliveries():
+					t.Errorf("dead-lettered %q", d.Body)
+				default:
+				}
+				return
+			}
+			d := receive(t, dead)
+			want := "gave up after 3 redeliveries"
+			if cause, _ := d.Headers[pubsub.HeaderError].(string); cause != want {
+				t.Errorf("%s = %q, want %q", pubsub.HeaderError, cause, want)
+			}
+		})
+	}
+}
+
+// publishRecorder is a MemoryBroker that remembers the options of every
+// publish.
+type publishRecorder struct {
+	*pubsub.MemoryBroker
+
+	mu   sync.Mutex
+	opts []pubsub.PublishOptions
+}
+
+func (r *publishRecorder) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing, opts pubsub.PublishOptions) error {
+	r.mu.Lock()
+	r.opts = append(r.opts, opts)
+	r.mu.Unlock()
+	return r.MemoryBroker.Publish(ctx, exchange, key, msg, opts)
+}
+
+func TestSettlerRepublishKeepsUserID(t *testing.T) {
+	tests := []struct {
+		name    string
+		acktype pubsub.AckType
+	}{
+		{name: "requeue", acktype: pubsub.NackRequeue},
+		{name: "retry", acktype: pubsub.RetryAfter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &publishRecorder{MemoryBroker: newBroker(t)}
+			deliveries := collect[string](t, b, "q", func(d pubsub.Delivery[string]) pubsub.AckType {
+				// Hand the message back once, then take it.
+				if d.Envelope.Headers[pubsub.HeaderRedeliveries] != nil || d.Envelope.Headers[pubsub.HeaderAttempts] != nil {
+					return pubsub.Ack
+				}
+				return tt.acktype
+			}, pubsub.WithRetryPolicy(pubsub.RetryPolicy{Delays: []time.Duration{time.Millisecond}}))
+
+			msg := amqp.Publishing{
+				ContentType: pubsub.JSON.ContentType(),
+				UserId:      "alice",
+				Body:        []byte(`"order"`),
+			}
+			if err := b.Publish(context.Background(), "direct", "q", msg, pubsub.PublishOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			next(t, deliveries)
+			if got := next(t, deliveries).Envelope.UserID; got != "alice" {
+				t.Errorf("redelivered with UserID %q, want alice", got)
+			}
+
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if len(b.opts) != 2 || !b.opts[1].Republish {
+				t.Errorf("published with %+v, want the second publish to be a republish", b.opts)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package pubsub
+
+import (
+	"context"
+	"log/slog"
+)
+
+type loggerKey struct{}
+
+// ContextWithLogger makes pubsub report diagnostics about work started with
+// ctx, such as publishes, subscriptions and their handlers, to logger.
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFromContext returns the logger set with ContextWithLogger, or
+// slog.Default() if there is none. Handlers can use it with
+// Delivery.Context().
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
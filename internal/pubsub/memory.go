@@ -0,0 +1,563 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var ErrBrokerClosed = errors.New("broker is closed")
+
+// MemoryBroker is an in-process Broker that mimics the parts of RabbitMQ the
+// game relies on: direct, topic and fanout exchanges, the default exchange,
+// durable and transient (exclusive, auto-delete) queues, prefetch,
+// ack/nack/requeue, x-message-ttl and dead-lettering through
+// x-dead-letter-exchange and x-dead-letter-routing-key.
+//
+// It is meant for tests: several game clients and a server can share one
+// MemoryBroker and exchange messages exactly as they would through RabbitMQ.
+type MemoryBroker struct {
+	mu        sync.Mutex
+	exchanges map[string]*memExchange
+	queues    map[string]*memQueue
+	nextQueue int
+	closed    bool
+}
+
+type memExchange struct {
+	name     string
+	kind     string
+	bindings []memBinding
+}
+
+type memBinding struct {
+	queue string
+	key   string
+}
+
+type memQueue struct {
+	name       string
+	durable    bool
+	autoDelete bool
+	exclusive  bool
+	args       amqp.Table
+
+	cond      *sync.Cond
+	ready     []memMessage
+	nextSeq   uint64
+	consumers map[*memConsumer]struct{}
+	deleted   bool
+}
+
+type memMessage struct {
+	seq      uint64
+	delivery amqp.Delivery
+}
+
+type memConsumer struct {
+	broker     *MemoryBroker
+	queue      *memQueue
+	prefetch   int
+	tag        string
+	deliveries chan amqp.Delivery
+	done       chan struct{}
+	nextTag    uint64
+	unacked    map[uint64]amqp.Delivery
+	cancelled  bool
+	cancelOnce sync.Once
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		exchanges: map[string]*memExchange{
+			"": {name: "", kind: amqp.ExchangeDirect},
+		},
+		queues: map[string]*memQueue{},
+	}
+}
+
+func (b *MemoryBroker) DeclareExchange(name, kind string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	switch kind {
+	case amqp.ExchangeDirect, amqp.ExchangeTopic, amqp.ExchangeFanout:
+	default:
+		return fmt.Errorf("unsupported exchange kind %q", kind)
+	}
+	if ex, ok := b.exchanges[name]; ok {
+		if ex.kind != kind {
+			return fmt.Errorf("exchange %q already declared as %s", name, ex.kind)
+		}
+		return nil
+	}
+	b.exchanges[name] = &memExchange{name: name, kind: kind}
+	return nil
+}
+
+func (b *MemoryBroker) DeclareQueue(name string, simpleQueueType SimpleQueueType, args amqp.Table) (amqp.Queue, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return amqp.Queue{}, ErrBrokerClosed
+	}
+	q, err := b.declareQueue(name, simpleQueueType == SimpleQueueDurable, args)
+	if err != nil {
+		return amqp.Queue{}, err
+	}
+	return b.queueInfo(q), nil
+}
+
+func (b *MemoryBroker) BindQueue(queueName, exchange, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	ex, ok := b.exchanges[exchange]
+	if !ok || exchange == "" {
+		return fmt.Errorf("no exchange %q to bind to", exchange)
+	}
+	if _, ok := b.queues[queueName]; !ok {
+		return fmt.Errorf("no queue %q to bind", queueName)
+	}
+
+	for _, binding := range ex.bindings {
+		if binding.queue == queueName && binding.key == key {
+			return nil
+		}
+	}
+	ex.bindings = append(ex.bindings, memBinding{queue: queueName, key: key})
+	return nil
+}
+
+// declareQueue must be called with b.mu held.
+func (b *MemoryBroker) declareQueue(name string, durable bool, args amqp.Table) (*memQueue, error) {
+	if name == "" {
+		b.nextQueue++
+		name = fmt.Sprintf("amq.gen-%d", b.nextQueue)
+	}
+	if q, ok := b.queues[name]; ok {
+		if q.durable != durable {
+			return nil, fmt.Errorf("queue %q already declared with durable=%v", name, q.durable)
+		}
+		if !reflect.DeepEqual(q.args, copyTable(args)) {
+			return nil, fmt.Errorf("queue %q already declared with arguments %v", name, q.args)
+		}
+		return q, nil
+	}
+	q := &memQueue{
+		name:       name,
+		durable:    durable,
+		autoDelete: !durable,
+		exclusive:  !durable,
+		args:       copyTable(args),
+		consumers:  map[*memConsumer]struct{}{},
+	}
+	q.cond = sync.NewCond(&b.mu)
+	b.queues[name] = q
+	return q, nil
+}
+
+func (b *MemoryBroker) queueInfo(q *memQueue) amqp.Queue {
+	return amqp.Queue{
+		Name:      q.name,
+		Messages:  len(q.ready),
+		Consumers: len(q.consumers),
+	}
+}
+
+// Publish routes msg synchronously, so a confirmed publish is acknowledged as
+// soon as it returns.
+func (b *MemoryBroker) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing, opts PublishOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	if _, ok := b.exchanges[exchange]; !ok {
+		return fmt.Errorf("no exchange %q", exchange)
+	}
+	if b.route(exchange, key, msg) == 0 && opts.Mandatory {
+		return &UnroutableError{
+			Exchange:  exchange,
+			Key:       key,
+			ReplyCode: amqp.NoRoute,
+			ReplyText: "NO_ROUTE",
+		}
+	}
+	return nil
+}
+
+// route delivers msg to every queue bound to exchange with a matching key and
+// reports how many queues received it. It must be called with b.mu held.
+func (b *MemoryBroker) route(exchange, key string, msg amqp.Publishing) int {
+	var targets []*memQueue
+	seen := map[string]bool{}
+
+	ex := b.exchanges[exchange]
+	if exchange == "" {
+		if q, ok := b.queues[key]; ok {
+			targets = append(targets, q)
+		}
+	} else {
+		for _, binding := range ex.bindings {
+			if seen[binding.queue] || !bindingMatches(ex.kind, binding.key, key) {
+				continue
+			}
+			if q, ok := b.queues[binding.queue]; ok {
+				seen[binding.queue] = true
+				targets = append(targets, q)
+			}
+		}
+	}
+
+	for _, q := range targets {
+		b.enqueue(q, newMemDelivery(exchange, key, msg))
+	}
+	return len(targets)
+}
+
+// enqueue must be called with b.mu held.
+func (b *MemoryBroker) enqueue(q *memQueue, d amqp.Delivery) {
+	q.nextSeq++
+	seq := q.nextSeq
+	q.ready = append(q.ready, memMessage{seq: seq, delivery: d})
+	q.cond.Broadcast()
+
+	if ttl := headerInt(q.args, "x-message-ttl"); ttl > 0 {
+		time.AfterFunc(time.Duration(ttl)*time.Millisecond, func() {
+			b.expire(q, seq)
+		})
+	}
+}
+
+// expire dead-letters a message that sat in q for longer than the queue's
+// x-message-ttl, unless a consumer took it in the meantime.
+func (b *MemoryBroker) expire(q *memQueue, seq uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, m := range q.ready {
+		if m.seq == seq {
+			q.ready = append(q.ready[:i], q.ready[i+1:]...)
+			b.deadLetter(q, m.delivery, "expired")
+			return
+		}
+	}
+}
+
+func newMemDelivery(exchange, key string, msg amqp.Publishing) amqp.Delivery {
+	return amqp.Delivery{
+		Headers:         copyTable(msg.Headers),
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		Exchange:        exchange,
+		RoutingKey:      key,
+		Body:            append([]byte(nil), msg.Body...),
+	}
+}
+
+func bindingMatches(kind, bindingKey, routingKey string) bool {
+	switch kind {
+	case amqp.ExchangeFanout:
+		return true
+	case amqp.ExchangeTopic:
+		return topicMatches(strings.Split(bindingKey, "."), strings.Split(routingKey, "."))
+	default:
+		return bindingKey == routingKey
+	}
+}
+
+// topicMatches reports whether the words of a routing key match the words of a
+// topic binding, where "*" matches exactly one word and "#" matches zero or
+// more words.
+func topicMatches(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if topicMatches(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && topicMatches(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && topicMatches(pattern[1:], words[1:])
+	}
+}
+
+func (b *MemoryBroker) Consume(queueName string, prefetch int) (Consumer, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+	q, ok := b.queues[queueName]
+	if !ok {
+		return nil, fmt.Errorf("no queue %q", queueName)
+	}
+	if q.exclusive && len(q.consumers) > 0 {
+		return nil, fmt.Errorf("queue %q is exclusive and already has a consumer", queueName)
+	}
+
+	c := &memConsumer{
+		broker:     b,
+		queue:      q,
+		prefetch:   prefetch,
+		tag:        fmt.Sprintf("ctag-%s-%d", q.name, time.Now().UnixNano()),
+		deliveries: make(chan amqp.Delivery),
+		done:       make(chan struct{}),
+		unacked:    map[uint64]amqp.Delivery{},
+	}
+	q.consumers[c] = struct{}{}
+	go c.run()
+	return c, nil
+}
+
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	var consumers []*memConsumer
+	for _, q := range b.queues {
+		for c := range q.consumers {
+			consumers = append(consumers, c)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, c := range consumers {
+		c.Cancel()
+	}
+	return nil
+}
+
+func (c *memConsumer) Deliveries() <-chan amqp.Delivery {
+	return c.deliveries
+}
+
+func (c *memConsumer) run() {
+	defer close(c.deliveries)
+	b := c.broker
+	q := c.queue
+
+	for {
+		b.mu.Lock()
+		for !c.cancelled && (len(q.ready) == 0 || (c.prefetch > 0 && len(c.unacked) >= c.prefetch)) {
+			q.cond.Wait()
+		}
+		if c.cancelled {
+			b.mu.Unlock()
+			return
+		}
+		d := q.ready[0].delivery
+		q.ready = q.ready[1:]
+		c.nextTag++
+		d.Acknowledger = c
+		d.DeliveryTag = c.nextTag
+		d.ConsumerTag = c.tag
+		c.unacked[d.DeliveryTag] = d
+		b.mu.Unlock()
+
+		select {
+		case c.deliveries <- d:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Cancel stops the consumer. Deliveries that were never acknowledged are
+// requeued, and a transient queue is deleted along with its last consumer.
+func (c *memConsumer) Cancel() error {
+	c.cancelOnce.Do(func() {
+		b := c.broker
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		c.cancelled = true
+		close(c.done)
+
+		q := c.queue
+		delete(q.consumers, c)
+		for tag := range c.unacked {
+			c.requeue(tag)
+		}
+		if q.autoDelete && len(q.consumers) == 0 {
+			b.deleteQueue(q)
+		}
+		q.cond.Broadcast()
+	})
+	return nil
+}
+
+// deleteQueue must be called with b.mu held.
+func (b *MemoryBroker) deleteQueue(q *memQueue) {
+	q.deleted = true
+	delete(b.queues, q.name)
+	for _, ex := range b.exchanges {
+		bindings := ex.bindings[:0]
+		for _, binding := range ex.bindings {
+			if binding.queue != q.name {
+				bindings = append(bindings, binding)
+			}
+		}
+		ex.bindings = bindings
+	}
+}
+
+func (c *memConsumer) Ack(tag uint64, multiple bool) error {
+	return c.settle(tag, multiple, func(tag uint64) {
+		delete(c.unacked, tag)
+	})
+}
+
+func (c *memConsumer) Nack(tag uint64, multiple bool, requeue bool) error {
+	return c.settle(tag, multiple, func(tag uint64) {
+		if requeue {
+			c.requeue(tag)
+			return
+		}
+		c.deadLetter(tag, "rejected")
+	})
+}
+
+func (c *memConsumer) Reject(tag uint64, requeue bool) error {
+	return c.Nack(tag, false, requeue)
+}
+
+func (c *memConsumer) settle(tag uint64, multiple bool, fn func(tag uint64)) error {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c.cancelled {
+		return fmt.Errorf("delivery %d: consumer %s is cancelled", tag, c.tag)
+	}
+	if _, ok := c.unacked[tag]; !ok {
+		return fmt.Errorf("unknown delivery tag %d", tag)
+	}
+	if multiple {
+		for t := range c.unacked {
+			if t <= tag {
+				fn(t)
+			}
+		}
+	} else {
+		fn(tag)
+	}
+	c.queue.cond.Broadcast()
+	return nil
+}
+
+// requeue must be called with b.mu held.
+func (c *memConsumer) requeue(tag uint64) {
+	d := c.unacked[tag]
+	delete(c.unacked, tag)
+	if c.queue.deleted {
+		return
+	}
+	d.Acknowledger = nil
+	d.Redelivered = true
+	q := c.queue
+	q.nextSeq++
+	q.ready = append([]memMessage{{seq: q.nextSeq, delivery: d}}, q.ready...)
+}
+
+// deadLetter must be called with b.mu held.
+func (c *memConsumer) deadLetter(tag uint64, reason string) {
+	d := c.unacked[tag]
+	delete(c.unacked, tag)
+	c.broker.deadLetter(c.queue, d, reason)
+}
+
+// deadLetter republishes d through q's x-dead-letter-exchange, if it has one.
+// It must be called with b.mu held.
+func (b *MemoryBroker) deadLetter(q *memQueue, d amqp.Delivery, reason string) {
+	dlx, ok := q.args["x-dead-letter-exchange"].(string)
+	if !ok {
+		return
+	}
+	if _, ok := b.exchanges[dlx]; !ok {
+		return
+	}
+	key := d.RoutingKey
+	if dlk, ok := q.args["x-dead-letter-routing-key"].(string); ok {
+		key = dlk
+	}
+
+	headers := copyTable(d.Headers)
+	headers["x-death"] = appendDeath(headers["x-death"], amqp.Table{
+		"count":        int64(1),
+		"reason":       reason,
+		"queue":        q.name,
+		"exchange":     d.Exchange,
+		"routing-keys": []interface{}{d.RoutingKey},
+		"time":         time.Now(),
+	})
+
+	msg := publishingFromDelivery(d)
+	msg.Headers = headers
+	msg.Expiration = ""
+	b.route(dlx, key, msg)
+}
+
+// appendDeath records a dead-lettering event the way RabbitMQ does: one
+// x-death entry per queue and reason, with a running count.
+func appendDeath(existing interface{}, death amqp.Table) []interface{} {
+	previous, _ := existing.([]interface{})
+	deaths := []interface{}{death}
+	for _, entry := range previous {
+		table, ok := entry.(amqp.Table)
+		if ok && table["queue"] == death["queue"] && table["reason"] == death["reason"] {
+			count, _ := table["count"].(int64)
+			death["count"] = count + 1
+			continue
+		}
+		deaths = append(deaths, entry)
+	}
+	return deaths
+}
+
+func copyTable(t amqp.Table) amqp.Table {
+	out := amqp.Table{}
+	for k, v := range t {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,355 @@
+package pubsub_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const receiveTimeout = 2 * time.Second
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"army_moves.*", "army_moves.alice", true},
+		{"army_moves.*", "army_moves", false},
+		{"army_moves.*", "army_moves.alice.extra", false},
+		{"*.alice", "army_moves.alice", true},
+		{"*", "", true},
+		{"#", "", true},
+		{"#", "a.b.c", true},
+		{"game_logs.#", "game_logs", true},
+		{"game_logs.#", "game_logs.alice.war", true},
+		{"#.war", "game_logs.alice.war", true},
+		{"#.war", "war", true},
+		{"#.war", "game_logs.alice", false},
+		{"a.#.z", "a.z", true},
+		{"a.#.z", "a.b.c.z", true},
+		{"a.*.#", "a", false},
+		{"a.*.#", "a.b", true},
+		{"pause", "pause", true},
+		{"pause", "paused", false},
+	}
+	for _, tt := range tests {
+		got := pubsub.TopicMatches(strings.Split(tt.pattern, "."), strings.Split(tt.key, "."))
+		if got != tt.want {
+			t.Errorf("topicMatches(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+}
+
+// newQueue declares exchange as kind and a durable queue bound to it with
+// key.
+func newQueue(t *testing.T, b *pubsub.MemoryBroker, exchange, kind, queue, key string, args amqp.Table) {
+	t.Helper()
+	if err := b.DeclareExchange(exchange, kind); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.DeclareQueue(queue, pubsub.SimpleQueueDurable, args); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.BindQueue(queue, exchange, key); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func publish(t *testing.T, b *pubsub.MemoryBroker, exchange, key, body string) {
+	t.Helper()
+	err := b.Publish(context.Background(), exchange, key, amqp.Publishing{Body: []byte(body)}, pubsub.PublishOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receive(t *testing.T, c pubsub.Consumer) amqp.Delivery {
+	t.Helper()
+	select {
+	case d, ok := <-c.Deliveries():
+		if !ok {
+			t.Fatal("consumer closed")
+		}
+		return d
+	case <-time.After(receiveTimeout):
+		t.Fatal("no delivery")
+	}
+	return amqp.Delivery{}
+}
+
+func consume(t *testing.T, b *pubsub.MemoryBroker, queue string) pubsub.Consumer {
+	t.Helper()
+	c, err := b.Consume(queue, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Cancel() })
+	return c
+}
+
+// messages counts the messages ready in queue.
+func messages(t *testing.T, b *pubsub.MemoryBroker, queue string, args amqp.Table) int {
+	t.Helper()
+	q, err := b.DeclareQueue(queue, pubsub.SimpleQueueDurable, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q.Messages
+}
+
+// newBroker returns a MemoryBroker with the exchanges subscriptions need: the
+// direct exchange "direct", and DeadLetterExchange feeding the queue "dlq".
+func newBroker(t *testing.T) *pubsub.MemoryBroker {
+	t.Helper()
+	b := pubsub.NewMemoryBroker()
+	t.Cleanup(func() { b.Close() })
+	if err := b.DeclareExchange("direct", amqp.ExchangeDirect); err != nil {
+		t.Fatal(err)
+	}
+	newQueue(t, b, pubsub.DeadLetterExchange, amqp.ExchangeFanout, "dlq", "", nil)
+	return b
+}
+
+// collect subscribes to queue, bound to "direct" with the queue's name as
+// its key. Every delivery is settled as settle says, then sent on the
+// returned channel.
+func collect[T any](t *testing.T, b pubsub.Broker, queue string, settle func(pubsub.Delivery[T]) pubsub.AckType, opts ...pubsub.SubscribeOption) <-chan pubsub.Delivery[T] {
+	t.Helper()
+	deliveries := make(chan pubsub.Delivery[T], 100)
+	sub, err := pubsub.SubscribeDelivery(
+		context.Background(),
+		b,
+		"direct",
+		queue,
+		queue,
+		pubsub.SimpleQueueDurable,
+		func(d pubsub.Delivery[T]) pubsub.AckType {
+			acktype := settle(d)
+			deliveries <- d
+			return acktype
+		},
+		opts...,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sub.Close() })
+	return deliveries
+}
+
+func ack[T any](pubsub.Delivery[T]) pubsub.AckType {
+	return pubsub.Ack
+}
+
+func next[T any](t *testing.T, deliveries <-chan pubsub.Delivery[T]) pubsub.Delivery[T] {
+	t.Helper()
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(receiveTimeout):
+		t.Fatal("no delivery")
+	}
+	return pubsub.Delivery[T]{}
+}
+
+// none checks that nothing more is delivered for a while.
+func none[T any](t *testing.T, deliveries <-chan pubsub.Delivery[T], wait time.Duration) {
+	t.Helper()
+	select {
+	case d := <-deliveries:
+		t.Fatalf("unexpected delivery %+v", d.Payload)
+	case <-time.After(wait):
+	}
+}
+
+func TestMemoryBrokerTopicRouting(t *testing.T) {
+	b := pubsub.NewMemoryBroker()
+	defer b.Close()
+	newQueue(t, b, "topic", amqp.ExchangeTopic, "one", "logs.*", nil)
+	newQueue(t, b, "topic", amqp.ExchangeTopic, "all", "logs.#", nil)
+
+	publish(t, b, "topic", "logs.alice", "a")
+	publish(t, b, "topic", "logs.alice.war", "b")
+	publish(t, b, "topic", "moves.alice", "c")
+
+	if got := messages(t, b, "one", nil); got != 1 {
+		t.Errorf("logs.* got %d messages, want 1", got)
+	}
+	if got := messages(t, b, "all", nil); got != 2 {
+		t.Errorf("logs.# got %d messages, want 2", got)
+	}
+}
+
+func TestMemoryBrokerAck(t *testing.T) {
+	b := pubsub.NewMemoryBroker()
+	defer b.Close()
+	newQueue(t, b, "direct", amqp.ExchangeDirect, "q", "key", nil)
+	publish(t, b, "direct", "key", "hello")
+
+	c := consume(t, b, "q")
+	d := receive(t, c)
+	if string(d.Body) != "hello" || d.Redelivered {
+		t.Fatalf("got %q redelivered=%v", d.Body, d.Redelivered)
+	}
+	if err := d.Ack(false); err != nil {
+		t.Fatal(err)
+	}
+	c.Cancel()
+	if got := messages(t, b, "q", nil); got != 0 {
+		t.Errorf("%d messages left after ack, want 0", got)
+	}
+}
+
+func TestMemoryBrokerNackRequeue(t *testing.T) {
+	b := pubsub.NewMemoryBroker()
+	defer b.Close()
+	newQueue(t, b, "direct", amqp.ExchangeDirect, "q", "key", nil)
+	publish(t, b, "direct", "key", "hello")
+
+	c := consume(t, b, "q")
+	if err := receive(t, c).Nack(false, true); err != nil {
+		t.Fatal(err)
+	}
+	d := receive(t, c)
+	if string(d.Body) != "hello" || !d.Redelivered {
+		t.Fatalf("got %q redelivered=%v, want the message redelivered", d.Body, d.Redelivered)
+	}
+	d.Ack(false)
+}
+
+func TestMemoryBrokerUnackedRequeuedOnCancel(t *testing.T) {
+	b := pubsub.NewMemoryBroker()
+	defer b.Close()
+	newQueue(t, b, "direct", amqp.ExchangeDirect, "q", "key", nil)
+	publish(t, b, "direct", "key", "hello")
+
+	c := consume(t, b, "q")
+	receive(t, c)
+	c.Cancel()
+	if got := messages(t, b, "q", nil); got != 1 {
+		t.Errorf("%d messages after cancelling with an unacked delivery, want 1", got)
+	}
+}
+
+func TestMemoryBrokerNackDiscard(t *testing.T) {
+	b := pubsub.NewMemoryBroker()
+	defer b.Close()
+	newQueue(t, b, "direct", amqp.ExchangeDirect, "q", "key", nil)
+	publish(t, b, "direct", "key", "hello")
+
+	c := consume(t, b, "q")
+	if err := receive(t, c).Nack(false, false); err != nil {
+		t.Fatal(err)
+	}
+	c.Cancel()
+	if got := messages(t, b, "q", nil); got != 0 {
+		t.Errorf("%d messages after discarding, want 0", got)
+	}
+}
+
+func TestMemoryBrokerDeadLetter(t *testing.T) {
+	b := pubsub.NewMemoryBroker()
+	defer b.Close()
+	args := amqp.Table{"x-dead-letter-exchange": "dlx"}
+	newQueue(t, b, "dlx", amqp.ExchangeFanout, "dlq", "", nil)
+	newQueue(t, b, "direct", amqp.ExchangeDirect, "q", "key", args)
+	publish(t, b, "direct", "key", "poison")
+
+	c := consume(t, b, "q")
+	if err := receive(t, c).Nack(false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	dead := receive(t, consume(t, b, "dlq"))
+	if string(dead.Body) != "poison" {
+		t.Fatalf("dead-lettered %q, want poison", dead.Body)
+	}
+	deaths, _ := dead.Headers["x-death"].([]interface{})
+	if len(deaths) != 1 {
+		t.Fatalf("x-death = %v, want one entry", dead.Headers["x-death"])
+	}
+	death := deaths[0].(amqp.Table)
+	if death["reason"] != "rejected" || death["queue"] != "q" || death["count"] != int64(1) {
+		t.Errorf("x-death entry = %v", death)
+	}
+}
+
+func TestMemoryBrokerTTL(t *testing.T) {
+	b := pubsub.NewMemoryBroker()
+	defer b.Close()
+	// parked holds messages for 20ms, then dead-letters them onto q
+	// through the default exchange.
+	args := amqp.Table{
+		"x-message-ttl":             int64(20),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": "q",
+	}
+	if _, err := b.DeclareQueue("q", pubsub.SimpleQueueDurable, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.DeclareQueue("parked", pubsub.SimpleQueueDurable, args); err != nil {
+		t.Fatal(err)
+	}
+	c := consume(t, b, "q")
+
+	start := time.Now()
+	publish(t, b, "", "parked", "later")
+	d := receive(t, c)
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("expired after %v, want at least 20ms", waited)
+	}
+	if string(d.Body) != "later" {
+		t.Errorf("got %q, want later", d.Body)
+	}
+	deaths, _ := d.Headers["x-death"].([]interface{})
+	if len(deaths) != 1 {
+		t.Fatalf("x-death = %v, want one entry", d.Headers["x-death"])
+	}
+	death := deaths[0].(amqp.Table)
+	if death["reason"] != "expired" || death["queue"] != "parked" {
+		t.Errorf("x-death entry = %v", death)
+	}
+}
+
+func TestMemoryBrokerTTLConsumed(t *testing.T) {
+	b := pubsub.NewMemoryBroker()
+	defer b.Close()
+	args := amqp.Table{"x-message-ttl": int64(20), "x-dead-letter-exchange": "dlx"}
+	newQueue(t, b, "dlx", amqp.ExchangeFanout, "dlq", "", nil)
+	newQueue(t, b, "direct", amqp.ExchangeDirect, "q", "key", args)
+	publish(t, b, "direct", "key", "soon")
+
+	// A message taken before its TTL runs out isn't expired, even if it is
+	// still unacknowledged when it does.
+	d := receive(t, consume(t, b, "q"))
+	time.Sleep(50 * time.Millisecond)
+	if err := d.Ack(false); err != nil {
+		t.Fatal(err)
+	}
+	if got := messages(t, b, "dlq", nil); got != 0 {
+		t.Errorf("%d messages dead-lettered, want none", got)
+	}
+}
+
+func TestMemoryBrokerMandatory(t *testing.T) {
+	b := pubsub.NewMemoryBroker()
+	defer b.Close()
+	if err := b.DeclareExchange("direct", amqp.ExchangeDirect); err != nil {
+		t.Fatal(err)
+	}
+	err := b.Publish(context.Background(), "direct", "nobody", amqp.Publishing{}, pubsub.PublishOptions{Mandatory: true})
+	var unroutable *pubsub.UnroutableError
+	if !errors.As(err, &unroutable) {
+		t.Fatalf("got %v, want an UnroutableError", err)
+	}
+	err = b.Publish(context.Background(), "direct", "nobody", amqp.Publishing{}, pubsub.PublishOptions{})
+	if err != nil {
+		t.Errorf("non-mandatory unroutable publish failed: %v", err)
+	}
+}
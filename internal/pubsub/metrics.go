@@ -0,0 +1,79 @@
+package pubsub
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Metrics are registered with the default Prometheus registry. Subscriptions
+// are labelled by route, the binding key they were subscribed with, so that
+// queues named after players don't each get their own series.
+var (
+	publishedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "peril",
+		Subsystem: "pubsub",
+		Name:      "published_total",
+		Help:      "Messages published, by exchange, payload type and result.",
+	}, []string{"exchange", "type", "result"})
+
+	publishDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "peril",
+		Subsystem: "pubsub",
+		Name:      "publish_duration_seconds",
+		Help:      "Time taken to publish a message, including waiting for a confirm.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"exchange"})
+
+	handledTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "peril",
+		Subsystem: "pubsub",
+		Name:      "handled_total",
+		Help:      "Deliveries handled, by route and the AckType the handler returned.",
+	}, []string{"route", "ack"})
+
+	handlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "peril",
+		Subsystem: "pubsub",
+		Name:      "handler_duration_seconds",
+		Help:      "Time handlers take to process a delivery.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route"})
+
+	deliveryLag = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "peril",
+		Subsystem: "pubsub",
+		Name:      "delivery_lag_seconds",
+		Help:      "Time between a message being published and its handler starting.",
+		Buckets:   []float64{.005, .01, .05, .1, .5, 1, 5, 10, 30, 60, 300},
+	}, []string{"route"})
+
+	decodeFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "peril",
+		Subsystem: "pubsub",
+		Name:      "decode_failures_total",
+		Help:      "Deliveries dead-lettered because their body could not be decoded.",
+	}, []string{"route"})
+)
+
+func observePublish(exchange, payloadType string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	publishedTotal.WithLabelValues(exchange, payloadType, result).Inc()
+	publishDuration.WithLabelValues(exchange).Observe(time.Since(start).Seconds())
+}
+
+func observeDelivery(route string, message amqp.Delivery, start time.Time) {
+	if !message.Timestamp.IsZero() {
+		deliveryLag.WithLabelValues(route).Observe(start.Sub(message.Timestamp).Seconds())
+	}
+}
+
+func observeHandled(route string, start time.Time, acktype AckType) {
+	handledTotal.WithLabelValues(route, acktype.String()).Inc()
+	handlerDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+}
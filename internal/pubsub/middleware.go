@@ -0,0 +1,110 @@
+package pubsub
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+// Handler processes one decoded delivery and says how to settle it.
+type Handler[T any] func(Delivery[T]) AckType
+
+// Middleware wraps a Handler to add behaviour around every message.
+type Middleware[T any] func(next Handler[T]) Handler[T]
+
+// Use adds middleware to a subscription. The first middleware is the
+// outermost one. Its type parameter must match the subscription's payload
+// type, or Subscribe fails.
+func Use[T any](middleware ...Middleware[T]) SubscribeOption {
+	return func(o *subscribeOptions) {
+		for _, mw := range middleware {
+			o.middleware = append(o.middleware, mw)
+		}
+	}
+}
+
+// Chain wraps handler in middleware, the first one outermost.
+func Chain[T any](handler Handler[T], middleware ...Middleware[T]) Handler[T] {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+func chainOptions[T any](handler Handler[T], middleware []any) (Handler[T], error) {
+	typed := make([]Middleware[T], 0, len(middleware))
+	for _, mw := range middleware {
+		m, ok := mw.(Middleware[T])
+		if !ok {
+			var zero T
+			return nil, fmt.Errorf("%T cannot wrap a handler for %T", mw, zero)
+		}
+		typed = append(typed, m)
+	}
+	return Chain(handler, typed...), nil
+}
+
+// Recover turns a panicking handler into a NackDiscard instead of letting it
+// crash the process.
+func Recover[T any]() Middleware[T] {
+	return func(next Handler[T]) Handler[T] {
+		return func(d Delivery[T]) (acktype AckType) {
+			defer func() {
+				if r := recover(); r != nil {
+					LoggerFromContext(d.Context()).Error("handler panicked",
+						"panic", r,
+						"message_id", d.Envelope.MessageID,
+						"stack", string(debug.Stack()),
+					)
+					acktype = NackDiscard
+				}
+			}()
+			return next(d)
+		}
+	}
+}
+
+// Timing reports how long each call to the handler took.
+func Timing[T any](observe func(time.Duration, AckType)) Middleware[T] {
+	return func(next Handler[T]) Handler[T] {
+		return func(d Delivery[T]) AckType {
+			start := time.Now()
+			acktype := next(d)
+			observe(time.Since(start), acktype)
+			return acktype
+		}
+	}
+}
+
+// Logging logs every handled message with its outcome and duration.
+func Logging[T any](logger *slog.Logger, queueName string) Middleware[T] {
+	return func(next Handler[T]) Handler[T] {
+		return func(d Delivery[T]) AckType {
+			start := time.Now()
+			acktype := next(d)
+			logger.Debug("handled message",
+				"queue", queueName,
+				"routing_key", d.Envelope.RoutingKey,
+				"message_id", d.Envelope.MessageID,
+				"correlation_id", d.Envelope.CorrelationID,
+				"sender", d.Envelope.Sender,
+				"type", fmt.Sprintf("%T", d.Payload),
+				"ack", acktype.String(),
+				"duration", time.Since(start),
+			)
+			return acktype
+		}
+	}
+}
+
+// RedrawPrompt prints prompt after every message, so an interactive user
+// gets their prompt back after a handler wrote to the terminal.
+func RedrawPrompt[T any](prompt string) Middleware[T] {
+	return func(next Handler[T]) Handler[T] {
+		return func(d Delivery[T]) AckType {
+			defer fmt.Print(prompt)
+			return next(d)
+		}
+	}
+}
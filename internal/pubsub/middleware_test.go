@@ -0,0 +1,145 @@
+package pubsub_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+)
+
+// record returns middleware that appends name to calls before and after the
+// handler it wraps.
+func record[T any](calls *[]string, name string) pubsub.Middleware[T] {
+	return func(next pubsub.Handler[T]) pubsub.Handler[T] {
+		return func(d pubsub.Delivery[T]) pubsub.AckType {
+			*calls = append(*calls, name+" before")
+			acktype := next(d)
+			*calls = append(*calls, fmt.Sprintf("%s after %v", name, acktype))
+			return acktype
+		}
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	handler := pubsub.Chain(func(pubsub.Delivery[string]) pubsub.AckType {
+		calls = append(calls, "handler")
+		return pubsub.NackRequeue
+	}, record[string](&calls, "outer"), record[string](&calls, "inner"))
+
+	if got := handler(pubsub.Delivery[string]{}); got != pubsub.NackRequeue {
+		t.Errorf("handler returned %v, want %v", got, pubsub.NackRequeue)
+	}
+	want := []string{
+		"outer before",
+		"inner before",
+		"handler",
+		"inner after " + pubsub.NackRequeue.String(),
+		"outer after " + pubsub.NackRequeue.String(),
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+}
+
+func TestUseOrder(t *testing.T) {
+	b := newBroker(t)
+	var calls []string
+	// handled is sent on once the outermost middleware has returned, so
+	// every call has been recorded.
+	handled := make(chan struct{})
+	done := func(next pubsub.Handler[string]) pubsub.Handler[string] {
+		return func(d pubsub.Delivery[string]) pubsub.AckType {
+			acktype := next(d)
+			handled <- struct{}{}
+			return acktype
+		}
+	}
+	collect(t, b, "q", ack[string],
+		pubsub.Use[string](done, record[string](&calls, "first")),
+		pubsub.Use(record[string](&calls, "second"), record[string](&calls, "third")),
+	)
+
+	if err := pubsub.PublishJSON(context.Background(), b, "direct", "q", "order"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-handled:
+	case <-time.After(receiveTimeout):
+		t.Fatal("no delivery")
+	}
+
+	want := []string{
+		"first before",
+		"second before",
+		"third before",
+		"third after " + pubsub.Ack.String(),
+		"second after " + pubsub.Ack.String(),
+		"first after " + pubsub.Ack.String(),
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+}
+
+func TestUseWrongType(t *testing.T) {
+	b := newBroker(t)
+	_, err := pubsub.SubscribeDelivery(
+		context.Background(),
+		b,
+		"direct",
+		"q",
+		"q",
+		pubsub.SimpleQueueDurable,
+		func(pubsub.Delivery[string]) pubsub.AckType { return pubsub.Ack },
+		pubsub.Use(pubsub.Recover[int]()),
+	)
+	if err == nil {
+		t.Fatal("subscribed with middleware for another payload type")
+	}
+}
+
+func TestRecover(t *testing.T) {
+	b := newBroker(t)
+	deliveries := make(chan pubsub.Delivery[string], 10)
+	sub, err := pubsub.SubscribeDelivery(
+		context.Background(),
+		b,
+		"direct",
+		"q",
+		"q",
+		pubsub.SimpleQueueDurable,
+		func(d pubsub.Delivery[string]) pubsub.AckType {
+			if d.Payload == "panic" {
+				panic("handler failed")
+			}
+			deliveries <- d
+			return pubsub.Ack
+		},
+		pubsub.Use(pubsub.Recover[string]()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sub.Close() })
+	dead := consume(t, b, "dlq")
+
+	for _, payload := range []string{"panic", "order"} {
+		if err := pubsub.PublishJSON(context.Background(), b, "direct", "q", payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The panicking message is discarded, so the queue dead-letters it,
+	// and the subscription carries on with the next one.
+	d := receive(t, dead)
+	if string(d.Body) != `"panic"` {
+		t.Errorf("dead-lettered %s, want the panicking message", d.Body)
+	}
+	if got := next(t, deliveries); got.Payload != "order" {
+		t.Errorf("handled %q after the panic, want order", got.Payload)
+	}
+}
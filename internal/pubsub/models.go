@@ -1,5 +1,11 @@
 package pubsub
 
+import (
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
 type SimpleQueueType int
 type AckType int
 
@@ -8,8 +14,118 @@ const (
 	SimpleQueueTransient
 )
 
+func (t SimpleQueueType) String() string {
+	switch t {
+	case SimpleQueueDurable:
+		return "durable"
+	case SimpleQueueTransient:
+		return "transient"
+	}
+	return fmt.Sprintf("SimpleQueueType(%d)", int(t))
+}
+
+func (t SimpleQueueType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *SimpleQueueType) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "durable":
+		*t = SimpleQueueDurable
+	case "transient":
+		*t = SimpleQueueTransient
+	default:
+		return fmt.Errorf("unknown queue type %q", text)
+	}
+	return nil
+}
+
 const (
 	Ack AckType = iota
 	NackRequeue
 	NackDiscard
+	// RetryAfter hands the message back to be redelivered after a delay set
+	// by the subscription's RetryPolicy.
+	RetryAfter
 )
+
+func (t AckType) String() string {
+	switch t {
+	case Ack:
+		return "ack"
+	case NackRequeue:
+		return "nack-requeue"
+	case NackDiscard:
+		return "nack-discard"
+	case RetryAfter:
+		return "retry-after"
+	}
+	return fmt.Sprintf("AckType(%d)", int(t))
+}
+
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	failurePolicy FailurePolicy
+	retryPolicy   RetryPolicy
+	middleware    []any
+	prefetch      int
+	workers       int
+	orderingKey   func(amqp.Delivery) string
+}
+
+func newSubscribeOptions(opts []SubscribeOption) subscribeOptions {
+	options := subscribeOptions{
+		failurePolicy: DefaultFailurePolicy,
+		retryPolicy:   DefaultRetryPolicy,
+		prefetch:      10,
+		workers:       1,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+func WithFailurePolicy(policy FailurePolicy) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.failurePolicy = policy
+	}
+}
+
+func WithRetryPolicy(policy RetryPolicy) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.retryPolicy = policy
+	}
+}
+
+// WithPrefetch sets how many unacknowledged deliveries the broker may send
+// ahead. It should be at least the number of workers.
+func WithPrefetch(n int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.prefetch = n
+	}
+}
+
+// WithWorkers handles up to n deliveries at once.
+func WithWorkers(n int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.workers = n
+	}
+}
+
+// WithOrderingKey keeps deliveries with the same key in order when there is
+// more than one worker.
+func WithOrderingKey(key func(amqp.Delivery) string) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.orderingKey = key
+	}
+}
+
+// OrderByRoutingKey keeps deliveries with the same routing key in order, e.g.
+// the logs of one player.
+func OrderByRoutingKey() SubscribeOption {
+	return WithOrderingKey(func(d amqp.Delivery) string {
+		return d.RoutingKey
+	})
+}
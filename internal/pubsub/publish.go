@@ -1,46 +1,34 @@
 package pubsub
 
 import (
-	"bytes"
 	"context"
-	"encoding/gob"
-	"encoding/json"
 
 	"github.com/rabbitmq/amqp091-go"
 )
 
-func PublishJSON[T any](ch *amqp091.Channel, exchange, key string, val T) error {
-	data, err := json.Marshal(val)
+// Publish encodes val with codec and publishes it, tagging the message with
+// the codec's content type so subscribers can pick the matching decoder, and
+// with an Envelope. If ctx comes from a Delivery, the new message is recorded
+// as caused by that delivery.
+func Publish[T any](ctx context.Context, pub Publisher, codec Codec, exchange, key string, val T, opts ...PublishOption) error {
+	data, err := codec.Marshal(val)
 	if err != nil {
 		return err
 	}
 
-	err = ch.PublishWithContext(context.Background(), exchange, key, false, false, amqp091.Publishing{
-		ContentType: "application/json",
+	msg := amqp091.Publishing{
+		ContentType: codec.ContentType(),
 		Body:        data,
-	})
-	if err != nil {
-		return err
 	}
+	stamp(ctx, &msg, val)
 
-	return nil
+	return publish(ctx, pub, exchange, key, msg, newPublishOptions(opts))
 }
 
-func PublishGob[T any](ch *amqp091.Channel, exchange, key string, val T) error {
-	var buffer bytes.Buffer
-	encoder := gob.NewEncoder(&buffer)
-	err := encoder.Encode(val)
-	if err != nil {
-		return err
-	}
-
-	err = ch.PublishWithContext(context.Background(), exchange, key, false, false, amqp091.Publishing{
-		ContentType: "application/gob",
-		Body:        buffer.Bytes(),
-	})
-	if err != nil {
-		return err
-	}
+func PublishJSON[T any](ctx context.Context, pub Publisher, exchange, key string, val T, opts ...PublishOption) error {
+	return Publish(ctx, pub, JSON, exchange, key, val, opts...)
+}
 
-	return nil
+func PublishGob[T any](ctx context.Context, pub Publisher, exchange, key string, val T, opts ...PublishOption) error {
+	return Publish(ctx, pub, Gob, exchange, key, val, opts...)
 }
@@ -0,0 +1,48 @@
+package pubsub
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RenameExchanges returns a Broker that uses names[x] wherever b would be
+// asked to use exchange x, including as a queue's dead-letter exchange. Code
+// written against fixed exchange names can then run against a broker where
+// they are called something else. Exchanges missing from names keep their
+// name.
+func RenameExchanges(b Broker, names map[string]string) Broker {
+	return &renamedBroker{Broker: b, names: names}
+}
+
+type renamedBroker struct {
+	Broker
+	names map[string]string
+}
+
+func (r *renamedBroker) rename(exchange string) string {
+	if name, ok := r.names[exchange]; ok && name != "" {
+		return name
+	}
+	return exchange
+}
+
+func (r *renamedBroker) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing, opts PublishOptions) error {
+	return r.Broker.Publish(ctx, r.rename(exchange), key, msg, opts)
+}
+
+func (r *renamedBroker) DeclareExchange(name, kind string) error {
+	return r.Broker.DeclareExchange(r.rename(name), kind)
+}
+
+func (r *renamedBroker) DeclareQueue(name string, simpleQueueType SimpleQueueType, args amqp.Table) (amqp.Queue, error) {
+	if dlx, ok := args["x-dead-letter-exchange"].(string); ok {
+		args = copyTable(args)
+		args["x-dead-letter-exchange"] = r.rename(dlx)
+	}
+	return r.Broker.DeclareQueue(name, simpleQueueType, args)
+}
+
+func (r *renamedBroker) BindQueue(queueName, exchange, key string) error {
+	return r.Broker.BindQueue(queueName, r.rename(exchange), key)
+}
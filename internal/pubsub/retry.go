@@ -0,0 +1,89 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// HeaderAttempts counts how many times a message has been retried.
+const HeaderAttempts = "x-peril-attempts"
+
+// RetryPolicy controls messages handed back with RetryAfter. Each retry parks
+// the message in a retry queue whose x-message-ttl is the delay; when it
+// expires the broker dead-letters it straight back onto the original queue.
+type RetryPolicy struct {
+	// Delays are used in order, one per attempt; the last one repeats.
+	Delays []time.Duration
+	// MaxAttempts caps how many times a message is tried in total before
+	// it is dead-lettered.
+	MaxAttempts int
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Delays:      []time.Duration{time.Second, 5 * time.Second, 30 * time.Second},
+	MaxAttempts: 5,
+}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	if len(p.Delays) == 0 {
+		return time.Second
+	}
+	if attempt >= len(p.Delays) {
+		return p.Delays[len(p.Delays)-1]
+	}
+	return p.Delays[attempt]
+}
+
+func retryQueueName(queueName string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%dms", queueName, delay.Milliseconds())
+}
+
+// retry parks the message in the retry queue for its next attempt, or
+// dead-letters it once it has used up its attempts.
+func (s *settler) retry(message amqp.Delivery) error {
+	attempts := headerInt(message.Headers, HeaderAttempts) + 1
+	if s.retryPolicy.MaxAttempts > 0 && attempts >= s.retryPolicy.MaxAttempts {
+		return s.deadLetter(message, fmt.Errorf("gave up after %d attempts", attempts))
+	}
+
+	retryQueue, err := s.retryQueue(s.retryPolicy.delay(attempts - 1))
+	if err != nil {
+		s.logger.Error("could not declare retry queue", "error", err)
+		return s.requeue(message)
+	}
+
+	msg := publishingFromDelivery(message)
+	msg.Headers[HeaderAttempts] = int64(attempts)
+	err = s.broker.Publish(context.Background(), "", retryQueue, msg, PublishOptions{Republish: true})
+	if err != nil {
+		s.logger.Error("could not publish to retry queue", "retry_queue", retryQueue, "error", err)
+		return s.requeue(message)
+	}
+	return message.Ack(false)
+}
+
+// retryQueue declares, once, the queue that holds messages for delay before
+// dead-lettering them back to the subscription's queue. It has the same
+// lifetime as the original queue.
+func (s *settler) retryQueue(delay time.Duration) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if name, ok := s.retryQueues[delay]; ok {
+		return name, nil
+	}
+	name := retryQueueName(s.queueName, delay)
+	_, err := s.broker.DeclareQueue(name, s.simpleQueueType, amqp.Table{
+		"x-message-ttl":             delay.Milliseconds(),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": s.queueName,
+	})
+	if err != nil {
+		return "", err
+	}
+	s.retryQueues[delay] = name
+	return name, nil
+}
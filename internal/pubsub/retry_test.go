@@ -0,0 +1,80 @@
+package pubsub_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+)
+
+func TestRetryAfter(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	b := newBroker(t)
+	deliveries := collect(t, b, "q", func(pubsub.Delivery[string]) pubsub.AckType {
+		return pubsub.RetryAfter
+	}, pubsub.WithRetryPolicy(pubsub.RetryPolicy{
+		Delays:      []time.Duration{delay},
+		MaxAttempts: 3,
+	}))
+	dead := consume(t, b, "dlq")
+
+	if err := pubsub.PublishJSON(context.Background(), b, "direct", "q", "order"); err != nil {
+		t.Fatal(err)
+	}
+
+	first := next(t, deliveries)
+	if _, ok := first.Envelope.Headers[pubsub.HeaderAttempts]; ok {
+		t.Errorf("first delivery has %s set", pubsub.HeaderAttempts)
+	}
+	last := time.Now()
+	for attempt := int64(1); attempt < 3; attempt++ {
+		d := next(t, deliveries)
+		if waited := time.Since(last); waited < delay {
+			t.Errorf("attempt %d came back after %v, want at least %v", attempt, waited, delay)
+		}
+		last = time.Now()
+		if got := d.Envelope.Headers[pubsub.HeaderAttempts]; got != attempt {
+			t.Errorf("%s = %v, want %d", pubsub.HeaderAttempts, got, attempt)
+		}
+		if d.Payload != "order" {
+			t.Errorf("payload = %q, want order", d.Payload)
+		}
+	}
+
+	d := receive(t, dead)
+	want := "gave up after 3 attempts"
+	if cause, _ := d.Headers[pubsub.HeaderError].(string); cause != want {
+		t.Errorf("%s = %q, want %q", pubsub.HeaderError, cause, want)
+	}
+	if d.Headers[pubsub.HeaderQueue] != "q" {
+		t.Errorf("%s = %v, want q", pubsub.HeaderQueue, d.Headers[pubsub.HeaderQueue])
+	}
+	none(t, deliveries, 2*delay)
+}
+
+func TestRetryDelays(t *testing.T) {
+	b := newBroker(t)
+	delays := []time.Duration{20 * time.Millisecond, 150 * time.Millisecond}
+	deliveries := collect(t, b, "q", func(d pubsub.Delivery[string]) pubsub.AckType {
+		if d.Envelope.Headers[pubsub.HeaderAttempts] == int64(3) {
+			return pubsub.Ack
+		}
+		return pubsub.RetryAfter
+	}, pubsub.WithRetryPolicy(pubsub.RetryPolicy{Delays: delays}))
+
+	if err := pubsub.PublishJSON(context.Background(), b, "direct", "q", "order"); err != nil {
+		t.Fatal(err)
+	}
+
+	next(t, deliveries)
+	// The last delay repeats once the list runs out.
+	for _, delay := range []time.Duration{delays[0], delays[1], delays[1]} {
+		sent := time.Now()
+		next(t, deliveries)
+		if waited := time.Since(sent); waited < delay {
+			t.Errorf("retried after %v, want at least %v", waited, delay)
+		}
+	}
+	none(t, deliveries, 200*time.Millisecond)
+}
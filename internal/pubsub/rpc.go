@@ -0,0 +1,130 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HeaderRPCError carries the error a Serve handler returned.
+const HeaderRPCError = "x-peril-rpc-error"
+
+// RemoteError is returned by Request when the server's handler failed.
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return "remote error: " + e.Message
+}
+
+// Request publishes req, encoded with codec, to exchange with key and waits
+// for the reply from whoever Serves that key, or until ctx expires. Each request gets its own
+// exclusive reply queue; the reply is matched to the request by correlation
+// ID. If no queue is bound for key, Request fails right away with an
+// *UnroutableError.
+func Request[Req, Resp any](ctx context.Context, broker Broker, codec Codec, exchange, key string, req Req) (Resp, error) {
+	var resp Resp
+	ctx, span := tracer().Start(ctx, "request "+key, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	replyQueue, err := broker.DeclareQueue("", SimpleQueueTransient, nil)
+	if err != nil {
+		return resp, fmt.Errorf("could not declare reply queue: %v", err)
+	}
+	consumer, err := broker.Consume(replyQueue.Name, 1)
+	if err != nil {
+		return resp, fmt.Errorf("could not consume reply queue: %v", err)
+	}
+	defer consumer.Cancel()
+
+	data, err := codec.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+	correlationID := newMessageID()
+	msg := amqp.Publishing{
+		ContentType:   codec.ContentType(),
+		CorrelationId: correlationID,
+		ReplyTo:       replyQueue.Name,
+		Body:          data,
+	}
+	stamp(ctx, &msg, req)
+	err = publish(ctx, broker, exchange, key, msg, PublishOptions{Confirm: true, Mandatory: true})
+	if err != nil {
+		return resp, err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		case reply, ok := <-consumer.Deliveries():
+			if !ok {
+				return resp, errors.New("reply queue closed before a reply arrived")
+			}
+			reply.Ack(false)
+			if reply.CorrelationId != correlationID {
+				continue
+			}
+			if remote, ok := reply.Headers[HeaderRPCError].(string); ok {
+				return resp, &RemoteError{Message: remote}
+			}
+			return decode[Resp](reply)
+		}
+	}
+}
+
+// Serve answers Requests sent to exchange with key. Each request is handled
+// like any other subscription; the handler's result or error is sent back to
+// the requester's reply queue, encoded with codec.
+func Serve[Req, Resp any](
+	ctx context.Context,
+	broker Broker,
+	codec Codec,
+	exchange,
+	queueName,
+	key string,
+	simpleQueueType SimpleQueueType,
+	handler func(context.Context, Req) (Resp, error),
+	opts ...SubscribeOption,
+) (*Subscription, error) {
+	return SubscribeDelivery(
+		ctx,
+		broker,
+		exchange,
+		queueName,
+		key,
+		simpleQueueType,
+		func(d Delivery[Req]) AckType {
+			if d.Envelope.ReplyTo == "" {
+				return NackDiscard
+			}
+
+			msg := amqp.Publishing{
+				ContentType:   codec.ContentType(),
+				CorrelationId: d.Envelope.RequestID,
+			}
+			resp, err := handler(d.Context(), d.Payload)
+			if err != nil {
+				msg.Headers = amqp.Table{HeaderRPCError: err.Error()}
+			} else {
+				msg.Body, err = codec.Marshal(resp)
+				if err != nil {
+					msg.Headers = amqp.Table{HeaderRPCError: err.Error()}
+				}
+			}
+			stamp(d.Context(), &msg, resp)
+
+			err = publish(d.Context(), broker, "", d.Envelope.ReplyTo, msg, PublishOptions{})
+			if err != nil {
+				return RetryAfter
+			}
+			return Ack
+		},
+		opts...,
+	)
+}
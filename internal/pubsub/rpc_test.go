@@ -0,0 +1,167 @@
+package pubsub_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// serve answers requests on the queue "rpc", bound to "direct" with the key
+// "rpc", with handler.
+func serve(t *testing.T, b pubsub.Broker, handler func(context.Context, int) (int, error)) {
+	t.Helper()
+	serveWith(t, b, pubsub.JSON, handler)
+}
+
+func serveWith[Req, Resp any](t *testing.T, b pubsub.Broker, codec pubsub.Codec, handler func(context.Context, Req) (Resp, error)) {
+	t.Helper()
+	sub, err := pubsub.Serve(context.Background(), b, codec, "direct", "rpc", "rpc", pubsub.SimpleQueueTransient, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sub.Close() })
+}
+
+func double(_ context.Context, n int) (int, error) {
+	return 2 * n, nil
+}
+
+func TestRequest(t *testing.T) {
+	b := newBroker(t)
+	serve(t, b, double)
+
+	got, err := pubsub.Request[int, int](context.Background(), b, pubsub.JSON, "direct", "rpc", 21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 42 {
+		t.Errorf("got %d, want 42", got)
+	}
+}
+
+func TestRequestCodec(t *testing.T) {
+	for _, codec := range []pubsub.Codec{pubsub.JSON, pubsub.Gob, pubsub.MessagePack} {
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			b := newBroker(t)
+			serveWith(t, b, codec, func(_ context.Context, req codecPayload) (codecPayload, error) {
+				req.Count *= 2
+				return req, nil
+			})
+			// spy gets a copy of every request.
+			newQueue(t, b, "direct", amqp.ExchangeDirect, "spy", "rpc", nil)
+			spy := consume(t, b, "spy")
+
+			req := codecPayload{Name: "alice", Count: 21, Tags: []string{"a"}}
+			got, err := pubsub.Request[codecPayload, codecPayload](context.Background(), b, codec, "direct", "rpc", req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := req
+			want.Count = 42
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+			if d := receive(t, spy); d.ContentType != codec.ContentType() {
+				t.Errorf("request sent as %q, want %q", d.ContentType, codec.ContentType())
+			}
+		})
+	}
+}
+
+func TestRequestCorrelation(t *testing.T) {
+	b := newBroker(t)
+	// Replies come back out of order: later requests are answered first.
+	serve(t, b, func(ctx context.Context, n int) (int, error) {
+		time.Sleep(time.Duration(10-n) * time.Millisecond)
+		return double(ctx, n)
+	})
+
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			got, err := pubsub.Request[int, int](context.Background(), b, pubsub.JSON, "direct", "rpc", n)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if got != 2*n {
+				t.Errorf("request %d: got %d, want %d", n, got, 2*n)
+			}
+		}(n)
+	}
+	wg.Wait()
+}
+
+func TestRequestRemoteError(t *testing.T) {
+	b := newBroker(t)
+	serve(t, b, func(_ context.Context, n int) (int, error) {
+		return 0, fmt.Errorf("no such unit %d", n)
+	})
+
+	_, err := pubsub.Request[int, int](context.Background(), b, pubsub.JSON, "direct", "rpc", 7)
+	var remote *pubsub.RemoteError
+	if !errors.As(err, &remote) {
+		t.Fatalf("got error %v, want a *RemoteError", err)
+	}
+	if remote.Message != "no such unit 7" {
+		t.Errorf("Message = %q, want the handler's error", remote.Message)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	b := newBroker(t)
+	release := make(chan struct{})
+	serve(t, b, func(ctx context.Context, n int) (int, error) {
+		<-release
+		return double(ctx, n)
+	})
+	// Cleanups run last first: let the handler return before the
+	// subscription is closed.
+	t.Cleanup(func() { close(release) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := pubsub.Request[int, int](ctx, b, pubsub.JSON, "direct", "rpc", 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if waited := time.Since(start); waited > receiveTimeout {
+		t.Errorf("gave up after %v", waited)
+	}
+}
+
+func TestRequestUnroutable(t *testing.T) {
+	b := newBroker(t)
+
+	_, err := pubsub.Request[int, int](context.Background(), b, pubsub.JSON, "direct", "rpc", 1)
+	var unroutable *pubsub.UnroutableError
+	if !errors.As(err, &unroutable) {
+		t.Fatalf("got error %v, want an *UnroutableError", err)
+	}
+}
+
+func TestServeCausation(t *testing.T) {
+	b := newBroker(t)
+	var request pubsub.Envelope
+	serve(t, b, func(ctx context.Context, n int) (int, error) {
+		request, _ = pubsub.EnvelopeFromContext(ctx)
+		return double(ctx, n)
+	})
+
+	if _, err := pubsub.Request[int, int](context.Background(), b, pubsub.JSON, "direct", "rpc", 1); err != nil {
+		t.Fatal(err)
+	}
+	if request.ReplyTo == "" || request.RequestID == "" {
+		t.Errorf("request envelope has ReplyTo %q and RequestID %q, want both", request.ReplyTo, request.RequestID)
+	}
+}
@@ -0,0 +1,71 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// Subscription is a running consumer started by SubscribeJSON or
+// SubscribeGob.
+type Subscription struct {
+	queueName string
+	consumer  Consumer
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	err      error
+}
+
+func newSubscription(queueName string, consumer Consumer) *Subscription {
+	return &Subscription{
+		queueName: queueName,
+		consumer:  consumer,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// QueueName is the name of the queue being consumed.
+func (s *Subscription) QueueName() string {
+	return s.queueName
+}
+
+// Drain stops taking new deliveries, lets the handler that is currently
+// running finish and settle its message, then closes the consumer. Messages
+// the broker had already prefetched are requeued. If ctx expires first the
+// subscription is closed immediately.
+func (s *Subscription) Drain(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	select {
+	case <-s.done:
+		return s.err
+	case <-ctx.Done():
+		s.Close()
+		return ctx.Err()
+	}
+}
+
+// Close cancels the consumer right away. A handler that is still running may
+// fail to settle its message, in which case the broker redelivers it.
+func (s *Subscription) Close() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	err := s.consumer.Cancel()
+	<-s.done
+	if err != nil {
+		return err
+	}
+	return s.err
+}
+
+// Wait blocks until the subscription has stopped and returns the error that
+// stopped it, if any.
+func (s *Subscription) Wait() error {
+	<-s.done
+	return s.err
+}
+
+// Done is closed once the subscription has stopped.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
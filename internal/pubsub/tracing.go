@@ -0,0 +1,100 @@
+package pubsub
+
+import (
+	"context"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+
+// propagator carries W3C trace context in message headers. It is used even
+// when no tracer provider is installed, so that a process that doesn't export
+// spans still passes its callers' trace on to the messages it publishes.
+var propagator = propagation.TraceContext{}
+
+// headerCarrier lets the propagator read and write amqp headers.
+type headerCarrier amqp.Table
+
+func (c headerCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// publish sends an already stamped msg inside a producer span, injecting the
+// span's context into the message headers, and records metrics for it.
+func publish(ctx context.Context, pub Publisher, exchange, key string, msg amqp.Publishing, opts PublishOptions) error {
+	ctx, span := tracer().Start(ctx, "publish "+exchange,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination.name", exchange),
+			attribute.String("messaging.rabbitmq.destination.routing_key", key),
+			attribute.String("messaging.message.id", msg.MessageId),
+			attribute.String("peril.message.type", msg.Type),
+		),
+	)
+	defer span.End()
+
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+	propagator.Inject(ctx, headerCarrier(msg.Headers))
+
+	start := time.Now()
+	err := pub.Publish(ctx, exchange, key, msg, opts)
+	observePublish(exchange, msg.Type, start, err)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	LoggerFromContext(ctx).Debug("published message",
+		"exchange", exchange,
+		"routing_key", key,
+		"message_id", msg.MessageId,
+		"type", msg.Type,
+	)
+	return nil
+}
+
+// startConsumerSpan starts the span a delivery is handled in, as a child of
+// the span that published it.
+func startConsumerSpan(ctx context.Context, route string, message amqp.Delivery) (context.Context, trace.Span) {
+	if message.Headers != nil {
+		ctx = propagator.Extract(ctx, headerCarrier(message.Headers))
+	}
+	return tracer().Start(ctx, "process "+route,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination.name", message.Exchange),
+			attribute.String("messaging.rabbitmq.destination.routing_key", message.RoutingKey),
+			attribute.String("messaging.message.id", message.MessageId),
+			attribute.String("peril.message.type", message.Type),
+			attribute.Bool("peril.redelivered", message.Redelivered),
+		),
+	)
+}
@@ -0,0 +1,243 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+)
+
+// Route describes one kind of message: the exchange it is published to, its
+// routing key pattern, the type of its payload and how the payload is
+// encoded. Publish keys and subscription bindings are both generated from the
+// pattern, so they can't drift apart.
+//
+// A pattern is a list of dot-separated words. A word in braces, like
+// {username}, is a named parameter: publishers must fill it in, subscribers
+// match any value.
+type Route[T any] struct {
+	Name     string
+	Exchange string
+	Pattern  string
+	Codec    pubsub.Codec
+
+	params []string
+}
+
+// Params are the values of a route's named parameters.
+type Params map[string]string
+
+// RouteInfo is the untyped description of a registered Route.
+type RouteInfo struct {
+	Name        string
+	Exchange    string
+	Pattern     string
+	Binding     string
+	ContentType string
+	PayloadType string
+}
+
+var registry = struct {
+	mu     sync.Mutex
+	routes map[string]RouteInfo
+}{
+	routes: map[string]RouteInfo{},
+}
+
+// NewRoute defines and registers a route. Routes are meant to be package
+// level variables, so it panics on a malformed pattern, a missing codec, a
+// name that is already taken, or a route that binds the same exchange and
+// pattern as another route with a different payload type: those are
+// programming errors that should stop the program at start-up.
+func NewRoute[T any](name, exchange, pattern string, codec pubsub.Codec) Route[T] {
+	params, err := parsePattern(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("route %s: %v", name, err))
+	}
+	if codec == nil {
+		panic(fmt.Sprintf("route %s has no codec", name))
+	}
+	r := Route[T]{
+		Name:     name,
+		Exchange: exchange,
+		Pattern:  pattern,
+		Codec:    codec,
+		params:   params,
+	}
+	register(r.Info())
+	return r
+}
+
+func register(info RouteInfo) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if _, ok := registry.routes[info.Name]; ok {
+		panic(fmt.Sprintf("route %s is already registered", info.Name))
+	}
+	for _, other := range registry.routes {
+		if other.Exchange == info.Exchange && other.Binding == info.Binding && other.PayloadType != info.PayloadType {
+			panic(fmt.Sprintf(
+				"route %s (%s) and route %s (%s) both bind %q on exchange %s",
+				info.Name, info.PayloadType, other.Name, other.PayloadType, info.Binding, info.Exchange,
+			))
+		}
+	}
+	registry.routes[info.Name] = info
+}
+
+// Routes lists every registered route by name.
+func Routes() []RouteInfo {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	routes := make([]RouteInfo, 0, len(registry.routes))
+	for _, info := range registry.routes {
+		routes = append(routes, info)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].Name < routes[j].Name
+	})
+	return routes
+}
+
+func (r Route[T]) Info() RouteInfo {
+	return RouteInfo{
+		Name:        r.Name,
+		Exchange:    r.Exchange,
+		Pattern:     r.Pattern,
+		Binding:     r.Binding(),
+		ContentType: r.Codec.ContentType(),
+		PayloadType: reflect.TypeFor[T]().String(),
+	}
+}
+
+// Key is the routing key to publish with. Every parameter in the pattern must
+// be given, and nothing else.
+func (r Route[T]) Key(params Params) (string, error) {
+	for name := range params {
+		if !r.hasParam(name) {
+			return "", fmt.Errorf("route %s has no parameter %q", r.Name, name)
+		}
+	}
+
+	words := strings.Split(r.Pattern, ".")
+	for i, word := range words {
+		name, ok := paramName(word)
+		if !ok {
+			continue
+		}
+		value, ok := params[name]
+		if !ok {
+			return "", fmt.Errorf("route %s is missing parameter %q", r.Name, name)
+		}
+		if value == "" || strings.ContainsAny(value, ".*#") {
+			return "", fmt.Errorf("route %s: invalid value %q for parameter %q", r.Name, value, name)
+		}
+		words[i] = value
+	}
+	return strings.Join(words, "."), nil
+}
+
+// Binding is the key to bind a queue with to receive every message on the
+// route, whatever its parameters.
+func (r Route[T]) Binding() string {
+	words := strings.Split(r.Pattern, ".")
+	for i, word := range words {
+		if _, ok := paramName(word); ok {
+			words[i] = "*"
+		}
+	}
+	return strings.Join(words, ".")
+}
+
+func (r Route[T]) hasParam(name string) bool {
+	for _, param := range r.params {
+		if param == name {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePattern(pattern string) ([]string, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	var params []string
+	for _, word := range strings.Split(pattern, ".") {
+		if name, ok := paramName(word); ok {
+			if name == "" {
+				return nil, fmt.Errorf("pattern %q has an unnamed parameter", pattern)
+			}
+			for _, param := range params {
+				if param == name {
+					return nil, fmt.Errorf("pattern %q repeats parameter %q", pattern, name)
+				}
+			}
+			params = append(params, name)
+			continue
+		}
+		if word == "" || strings.ContainsAny(word, "*#{}") {
+			return nil, fmt.Errorf("pattern %q has an invalid word %q", pattern, word)
+		}
+	}
+	return params, nil
+}
+
+func paramName(word string) (string, bool) {
+	if !strings.HasPrefix(word, "{") || !strings.HasSuffix(word, "}") {
+		return "", false
+	}
+	return word[1 : len(word)-1], true
+}
+
+// Publish publishes val on r with the key made from params.
+func Publish[T any](ctx context.Context, pub pubsub.Publisher, r Route[T], params Params, val T, opts ...pubsub.PublishOption) error {
+	key, err := r.Key(params)
+	if err != nil {
+		return err
+	}
+	return pubsub.Publish(ctx, pub, r.Codec, r.Exchange, key, val, opts...)
+}
+
+// Subscribe binds queueName to every message on r and hands them to handler.
+func Subscribe[T any](
+	ctx context.Context,
+	broker pubsub.Broker,
+	r Route[T],
+	queueName string,
+	simpleQueueType pubsub.SimpleQueueType,
+	handler pubsub.Handler[T],
+	opts ...pubsub.SubscribeOption,
+) (*pubsub.Subscription, error) {
+	return pubsub.SubscribeDelivery(ctx, broker, r.Exchange, queueName, r.Binding(), simpleQueueType, handler, opts...)
+}
+
+// Request sends req on r and waits for the reply of whoever Serves r. Both
+// are encoded with r's codec.
+func Request[Req, Resp any](ctx context.Context, broker pubsub.Broker, r Route[Req], params Params, req Req) (Resp, error) {
+	key, err := r.Key(params)
+	if err != nil {
+		var resp Resp
+		return resp, err
+	}
+	return pubsub.Request[Req, Resp](ctx, broker, r.Codec, r.Exchange, key, req)
+}
+
+// Serve answers every Request sent on r from queueName.
+func Serve[Req, Resp any](
+	ctx context.Context,
+	broker pubsub.Broker,
+	r Route[Req],
+	queueName string,
+	simpleQueueType pubsub.SimpleQueueType,
+	handler func(context.Context, Req) (Resp, error),
+	opts ...pubsub.SubscribeOption,
+) (*pubsub.Subscription, error) {
+	return pubsub.Serve(ctx, broker, r.Codec, r.Exchange, queueName, r.Binding(), simpleQueueType, handler, opts...)
+}
@@ -0,0 +1,84 @@
+package routing
+
+import (
+	"strings"
+	"testing"
+)
+
+// testRoute builds a route without registering it.
+func testRoute(t *testing.T, pattern string) Route[string] {
+	t.Helper()
+	params, err := parsePattern(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Route[string]{Name: "test", Pattern: pattern, params: params}
+}
+
+func TestRouteKey(t *testing.T) {
+	tests := []struct {
+		pattern string
+		params  Params
+		want    string
+		wantErr string
+	}{
+		{pattern: "pause", want: "pause"},
+		{pattern: "pause", params: Params{}, want: "pause"},
+		{pattern: "army_moves.{username}", params: Params{"username": "alice"}, want: "army_moves.alice"},
+		{pattern: "game_logs.{username}.{kind}", params: Params{"username": "bob", "kind": "war"}, want: "game_logs.bob.war"},
+		{pattern: "{region}.moves.{username}", params: Params{"region": "eu", "username": "bob"}, want: "eu.moves.bob"},
+		{pattern: "army_moves.{username}", wantErr: "missing parameter"},
+		{pattern: "army_moves.{username}", params: Params{"username": "alice", "extra": "x"}, wantErr: "no parameter"},
+		{pattern: "pause", params: Params{"username": "alice"}, wantErr: "no parameter"},
+		{pattern: "army_moves.{username}", params: Params{"username": ""}, wantErr: "invalid value"},
+		{pattern: "army_moves.{username}", params: Params{"username": "a.b"}, wantErr: "invalid value"},
+		{pattern: "army_moves.{username}", params: Params{"username": "*"}, wantErr: "invalid value"},
+		{pattern: "army_moves.{username}", params: Params{"username": "#"}, wantErr: "invalid value"},
+	}
+	for _, tt := range tests {
+		got, err := testRoute(t, tt.pattern).Key(tt.params)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Key(%q, %v) error = %v, want %q", tt.pattern, tt.params, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Key(%q, %v) = %q, %v; want %q", tt.pattern, tt.params, got, err, tt.want)
+		}
+	}
+}
+
+func TestRouteBinding(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"pause", "pause"},
+		{"army_moves.{username}", "army_moves.*"},
+		{"game_logs.{username}.{kind}", "game_logs.*.*"},
+		{"{region}.moves", "*.moves"},
+	}
+	for _, tt := range tests {
+		if got := testRoute(t, tt.pattern).Binding(); got != tt.want {
+			t.Errorf("Binding(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestParsePatternErrors(t *testing.T) {
+	for _, pattern := range []string{
+		"",
+		"army_moves.",
+		"army_moves..x",
+		"army_moves.*",
+		"game_logs.#",
+		"army_moves.{}",
+		"army_moves.{username}.{username}",
+		"army_moves.user}",
+	} {
+		if _, err := parsePattern(pattern); err == nil {
+			t.Errorf("parsePattern(%q) succeeded, want an error", pattern)
+		}
+	}
+}
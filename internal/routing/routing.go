@@ -1,9 +1,17 @@
 package routing
 
+import "github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+
 const (
 	ArmyMovesPrefix = "army_moves"
 
-	WarRecognitionsPrefix = "war"
+	ArmySpawnsPrefix = "army_spawns"
+
+	WorldDeltasPrefix = "world_deltas"
+
+	WorldSnapshotsPrefix = "world_snapshots"
+
+	WorldSnapshotKey = "world_snapshot"
 
 	PauseKey = "pause"
 
@@ -14,3 +22,8 @@ const (
 	ExchangePerilDirect = "peril_direct"
 	ExchangePerilTopic  = "peril_topic"
 )
+
+var (
+	PauseRoute   = NewRoute[PlayingState]("pause", ExchangePerilDirect, PauseKey, pubsub.JSON)
+	GameLogRoute = NewRoute[GameLog]("game_log", ExchangePerilTopic, GameLogSlug+".{username}", pubsub.Gob)
+)
@@ -0,0 +1,278 @@
+// Package server runs the authoritative side of a game: it owns the World,
+// applies the orders players send, and publishes what changed.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/persistence"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// Sender is the name the server publishes under.
+const Sender = "peril-server"
+
+const publishTimeout = 5 * time.Second
+
+// Config is what a Game needs besides its World.
+type Config struct {
+	Publisher pubsub.Publisher
+	Store     persistence.Store
+	// Events records every change, if set.
+	Events *persistence.EventLog
+	// VerifySenders checks orders against the broker user that published
+	// them instead of the sender the publisher names itself.
+	VerifySenders bool
+}
+
+// Game owns the World. Changes to it are made and published one at a time,
+// so deltas go out in the order they were applied.
+type Game struct {
+	mu            sync.Mutex
+	world         *gamelogic.World
+	publisher     pubsub.Publisher
+	store         persistence.Store
+	events        *persistence.EventLog
+	verifySenders bool
+}
+
+func NewGame(world *gamelogic.World, cfg Config) *Game {
+	return &Game{
+		world:         world,
+		publisher:     cfg.Publisher,
+		store:         cfg.Store,
+		events:        cfg.Events,
+		verifySenders: cfg.VerifySenders,
+	}
+}
+
+// Start records the world the game starts from, and the rules and map it is
+// played with, so the event log can be replayed from scratch.
+func (g *Game) Start(logger *slog.Logger, rules gamelogic.Rules, worldMap *gamelogic.Map) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	start := g.world.Snapshot()
+	g.record(logger, gamelogic.Event{
+		Kind:     gamelogic.EventStart,
+		Rules:    &rules,
+		Map:      worldMap,
+		Snapshot: &start,
+	})
+}
+
+func (g *Game) Paused() bool {
+	return g.world.Paused()
+}
+
+func (g *Game) SetPaused(ctx context.Context, paused bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delta := g.world.SetPaused(paused)
+	g.record(pubsub.LoggerFromContext(ctx), gamelogic.Event{
+		Kind:   gamelogic.EventPause,
+		Paused: paused,
+		Deltas: []gamelogic.WorldDelta{delta},
+	})
+	err := g.publishDelta(ctx, Sender, delta)
+	if err != nil {
+		pubsub.LoggerFromContext(ctx).Error("could not publish world delta", "error", err)
+	}
+	return publishPlayingState(ctx, g.publisher, routing.PlayingState{IsPaused: paused})
+}
+
+// order applies a player's spawn or move to the World and publishes the
+// result, or tells the player why it was refused. Orders must come from the
+// player they are for. Unless verifySenders is set, that is only checked
+// against the sender the client names itself, which catches mistakes but not
+// impersonation. event describes the order, for the event log.
+func (g *Game) order(ctx context.Context, username string, env pubsub.Envelope, event gamelogic.Event, change func() ([]gamelogic.WorldDelta, error)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	logger := pubsub.LoggerFromContext(ctx)
+	sender := env.Sender
+	if g.verifySenders {
+		sender = env.UserID
+	}
+	var deltas []gamelogic.WorldDelta
+	err := fmt.Errorf("order for %q was sent by %q", username, sender)
+	if sender == username {
+		deltas, err = change()
+	}
+	if err == nil {
+		event.Deltas = deltas
+		g.record(logger, event)
+	} else {
+		logger.Warn("refused order", "player", username, "error", err)
+		deltas = []gamelogic.WorldDelta{{
+			Kind:     gamelogic.DeltaRejected,
+			Username: username,
+			Reason:   err.Error(),
+		}}
+	}
+	for _, delta := range deltas {
+		err := g.publishDelta(ctx, username, delta)
+		if err != nil {
+			logger.Error("could not publish world delta", "kind", delta.Kind, "error", err)
+		}
+	}
+}
+
+func (g *Game) publishDelta(ctx context.Context, username string, delta gamelogic.WorldDelta) error {
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	err := routing.Publish(
+		ctx,
+		g.publisher,
+		gamelogic.WorldDeltasRoute,
+		routing.Params{"username": username},
+		delta,
+		pubsub.WithConfirm(),
+	)
+	if err != nil || delta.War == nil {
+		return err
+	}
+	return publishGameLog(ctx, g.publisher, username, warLog(*delta.War))
+}
+
+// Snapshot is taken between changes, so it matches the deltas published so
+// far.
+func (g *Game) Snapshot() gamelogic.WorldSnapshot {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.world.Snapshot()
+}
+
+// BroadcastSnapshots publishes a snapshot every interval until ctx is done,
+// so clients that missed deltas catch up.
+func (g *Game) BroadcastSnapshots(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		publishCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+		err := routing.Publish(publishCtx, g.publisher, gamelogic.WorldSnapshotsRoute, nil, g.Snapshot())
+		cancel()
+		if err != nil {
+			pubsub.LoggerFromContext(ctx).Error("could not publish world snapshot", "error", err)
+		}
+	}
+}
+
+// record appends e to the event log. Callers hold g.mu, so events are
+// logged in the order they were applied.
+func (g *Game) record(logger *slog.Logger, e gamelogic.Event) {
+	if g.events == nil {
+		return
+	}
+	_, err := g.events.Append(e)
+	if err != nil {
+		logger.Error("could not record event", "kind", e.Kind, "error", err)
+	}
+}
+
+func (g *Game) Save(name string) error {
+	return g.store.Save(name, g.Snapshot())
+}
+
+// Saves lists the names of the saved worlds.
+func (g *Game) Saves() ([]string, error) {
+	return g.store.List()
+}
+
+// Load replaces the world with a save, and tells clients to start over from
+// it.
+func (g *Game) Load(ctx context.Context, name string) error {
+	saved, err := g.store.Load(name)
+	if err != nil {
+		return fmt.Errorf("could not load %s: %w", name, err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	snapshot := g.world.Load(saved)
+	g.record(pubsub.LoggerFromContext(ctx), gamelogic.Event{Kind: gamelogic.EventLoad, Snapshot: &snapshot})
+	publishCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	err = routing.Publish(publishCtx, g.publisher, gamelogic.WorldSnapshotsRoute, nil, snapshot)
+	if err != nil {
+		return fmt.Errorf("could not publish world snapshot: %w", err)
+	}
+	return publishPlayingState(ctx, g.publisher, routing.PlayingState{IsPaused: snapshot.Paused})
+}
+
+// Checkpoints saves the world every interval until ctx is done, so a crash
+// loses at most interval of play.
+func (g *Game) Checkpoints(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := g.Save(persistence.CheckpointName)
+		if err != nil {
+			pubsub.LoggerFromContext(ctx).Error("could not save checkpoint", "error", err)
+		}
+	}
+}
+
+func warLog(war gamelogic.War) string {
+	if war.Outcome == gamelogic.WarOutcomeDraw {
+		return "A war between " + war.Attacker + " and " + war.Defender + " resulted in a draw"
+	}
+	return war.Winner() + " won a war against " + war.Loser()
+}
+
+func publishGameLog(ctx context.Context, publisher pubsub.Publisher, username, msg string) error {
+	return routing.Publish(
+		ctx,
+		publisher,
+		routing.GameLogRoute,
+		routing.Params{"username": username},
+		routing.GameLog{
+			CurrentTime: time.Now(),
+			Message:     msg,
+			Username:    username,
+		},
+		pubsub.WithConfirm(),
+	)
+}
+
+// publishPlayingState broadcasts a pause or resume and waits for the broker to
+// confirm it, reporting when no client was there to receive it.
+func publishPlayingState(ctx context.Context, publisher pubsub.Publisher, ps routing.PlayingState) error {
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+
+	err := routing.Publish(
+		ctx,
+		publisher,
+		routing.PauseRoute,
+		nil,
+		ps,
+		pubsub.WithMandatory(),
+	)
+	var unroutable *pubsub.UnroutableError
+	if errors.As(err, &unroutable) {
+		fmt.Println("No players are connected to receive it.")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not publish playing state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// publishRecorder keeps every message published through it, in order.
+type publishRecorder struct {
+	mu       sync.Mutex
+	messages []published
+}
+
+type published struct {
+	exchange, key string
+	msg           amqp.Publishing
+}
+
+func (r *publishRecorder) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing, opts pubsub.PublishOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, published{exchange: exchange, key: key, msg: msg})
+	return nil
+}
+
+// deltas decodes the world deltas published so far, with the routing key
+// each was published with.
+func (r *publishRecorder) deltas(t *testing.T) ([]gamelogic.WorldDelta, []string) {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deltas []gamelogic.WorldDelta
+	var keys []string
+	for _, m := range r.messages {
+		if !strings.HasPrefix(m.key, routing.WorldDeltasPrefix+".") {
+			continue
+		}
+		var d gamelogic.WorldDelta
+		if err := json.Unmarshal(m.msg.Body, &d); err != nil {
+			t.Fatal(err)
+		}
+		deltas = append(deltas, d)
+		keys = append(keys, m.key)
+	}
+	return deltas, keys
+}
+
+func newTestGame(t *testing.T, verifySenders bool) (*Game, *publishRecorder) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	world := gamelogic.NewWorld(gamelogic.DefaultRules(), gamelogic.ClassicMap(), logger)
+	publisher := &publishRecorder{}
+	return NewGame(world, Config{Publisher: publisher, VerifySenders: verifySenders}), publisher
+}
+
+// delivery is payload as delivered with env.
+func delivery[T any](payload T, env pubsub.Envelope) pubsub.Delivery[T] {
+	return pubsub.Delivery[T]{Payload: payload, Envelope: env}
+}
+
+func TestOrderSender(t *testing.T) {
+	spawn := gamelogic.ArmySpawn{Username: "alice", Location: "scandinavia", Rank: gamelogic.RankInfantry}
+	tests := []struct {
+		name          string
+		verifySenders bool
+		env           pubsub.Envelope
+		wantRefused   string
+	}{
+		{name: "named sender", env: pubsub.Envelope{Sender: "alice"}},
+		{name: "other named sender", env: pubsub.Envelope{Sender: "bob"}, wantRefused: `order for "alice" was sent by "bob"`},
+		{name: "no sender", env: pubsub.Envelope{}, wantRefused: `order for "alice" was sent by ""`},
+		{name: "broker user ignored", env: pubsub.Envelope{Sender: "alice", UserID: "bob"}},
+		{name: "verified user", verifySenders: true, env: pubsub.Envelope{Sender: "mallory", UserID: "alice"}},
+		{name: "other verified user", verifySenders: true, env: pubsub.Envelope{Sender: "alice", UserID: "bob"}, wantRefused: `order for "alice" was sent by "bob"`},
+		{name: "no verified user", verifySenders: true, env: pubsub.Envelope{Sender: "alice"}, wantRefused: `order for "alice" was sent by ""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game, publisher := newTestGame(t, tt.verifySenders)
+
+			if got := HandlerSpawn(game)(delivery(spawn, tt.env)); got != pubsub.Ack {
+				t.Errorf("handler returned %v, want %v", got, pubsub.Ack)
+			}
+
+			deltas, keys := publisher.deltas(t)
+			if len(deltas) != 1 {
+				t.Fatalf("published %d deltas, want 1", len(deltas))
+			}
+			// Either way the answer goes to the player the order was for.
+			if keys[0] != routing.WorldDeltasPrefix+".alice" {
+				t.Errorf("published with key %q", keys[0])
+			}
+			_, spawned := game.world.Player("alice")
+			if tt.wantRefused == "" {
+				if deltas[0].Kind != gamelogic.DeltaSpawn || !spawned {
+					t.Errorf("published %s and spawned %t, want the spawn", deltas[0].Kind, spawned)
+				}
+				return
+			}
+			if deltas[0].Kind != gamelogic.DeltaRejected || deltas[0].Reason != tt.wantRefused {
+				t.Errorf("published %s %q, want %s %q", deltas[0].Kind, deltas[0].Reason, gamelogic.DeltaRejected, tt.wantRefused)
+			}
+			if spawned {
+				t.Error("refused order changed the world")
+			}
+		})
+	}
+}
+
+func TestOrderRefusedByWorld(t *testing.T) {
+	game, publisher := newTestGame(t, false)
+	move := gamelogic.ArmyMove{
+		Player:     gamelogic.Player{Username: "alice"},
+		Units:      []gamelogic.Unit{{ID: 1}},
+		ToLocation: "ukraine",
+	}
+
+	HandlerMove(game)(delivery(move, pubsub.Envelope{Sender: "alice"}))
+
+	deltas, _ := publisher.deltas(t)
+	want := []gamelogic.WorldDelta{{
+		Kind:     gamelogic.DeltaRejected,
+		Username: "alice",
+		Reason:   `player "alice" has no units`,
+	}}
+	if !reflect.DeepEqual(deltas, want) {
+		t.Errorf("published %+v, want %+v", deltas, want)
+	}
+}
+
+func TestGameDeltaSequence(t *testing.T) {
+	game, publisher := newTestGame(t, false)
+	ctx := pubsub.ContextWithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	spawn := HandlerSpawn(game)
+	move := HandlerMove(game)
+
+	spawn(delivery(gamelogic.ArmySpawn{Username: "alice", Location: "scandinavia", Rank: gamelogic.RankArtillery}, pubsub.Envelope{Sender: "alice"}))
+	spawn(delivery(gamelogic.ArmySpawn{Username: "bob", Location: "ukraine", Rank: gamelogic.RankInfantry}, pubsub.Envelope{Sender: "bob"}))
+	// Refused orders don't use up a sequence number.
+	spawn(delivery(gamelogic.ArmySpawn{Username: "bob", Location: "ukraine", Rank: gamelogic.RankInfantry}, pubsub.Envelope{Sender: "alice"}))
+	move(delivery(gamelogic.ArmyMove{
+		Player:     gamelogic.Player{Username: "alice"},
+		Units:      []gamelogic.Unit{{ID: 1}},
+		ToLocation: "ukraine",
+	}, pubsub.Envelope{Sender: "alice"}))
+	if err := game.SetPaused(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+
+	deltas, keys := publisher.deltas(t)
+	wantKinds := []gamelogic.DeltaKind{
+		gamelogic.DeltaSpawn,
+		gamelogic.DeltaSpawn,
+		gamelogic.DeltaRejected,
+		gamelogic.DeltaMove,
+		gamelogic.DeltaWar,
+		gamelogic.DeltaPause,
+	}
+	wantKeys := []string{"alice", "bob", "bob", "alice", "alice", Sender}
+	if len(deltas) != len(wantKinds) {
+		t.Fatalf("published %d deltas, want %d", len(deltas), len(wantKinds))
+	}
+	seq := uint64(0)
+	epoch := game.world.Epoch()
+	for i, d := range deltas {
+		if d.Kind != wantKinds[i] {
+			t.Errorf("delta %d is %s, want %s", i, d.Kind, wantKinds[i])
+		}
+		if keys[i] != routing.WorldDeltasPrefix+"."+wantKeys[i] {
+			t.Errorf("delta %d published with key %q, want one for %s", i, keys[i], wantKeys[i])
+		}
+		if d.Kind == gamelogic.DeltaRejected {
+			if d.Seq != 0 {
+				t.Errorf("rejection has Seq %d, want none", d.Seq)
+			}
+			continue
+		}
+		seq++
+		if d.Seq != seq || d.Epoch != epoch {
+			t.Errorf("delta %d (%s) is %d in %q, want %d in %q", i, d.Kind, d.Seq, d.Epoch, seq, epoch)
+		}
+	}
+	if got := game.Snapshot().Seq; got != seq {
+		t.Errorf("snapshot is at Seq %d, want %d", got, seq)
+	}
+
+	// The war is announced in the attacker's game log too.
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+	logs := 0
+	for _, m := range publisher.messages {
+		if m.key == routing.GameLogSlug+".alice" {
+			logs++
+		}
+	}
+	if logs != 1 {
+		t.Errorf("published %d game logs for alice, want 1", logs)
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+)
+
+// HandlerWorldSnapshot answers clients asking for the whole world.
+func HandlerWorldSnapshot(game *Game) func(context.Context, gamelogic.WorldSnapshotRequest) (gamelogic.WorldSnapshot, error) {
+	return func(ctx context.Context, _ gamelogic.WorldSnapshotRequest) (gamelogic.WorldSnapshot, error) {
+		return game.Snapshot(), nil
+	}
+}
+
+func HandlerSpawn(game *Game) pubsub.Handler[gamelogic.ArmySpawn] {
+	return func(d pubsub.Delivery[gamelogic.ArmySpawn]) pubsub.AckType {
+		event := gamelogic.Event{Kind: gamelogic.EventSpawn, Spawn: &d.Payload}
+		game.order(d.Context(), d.Payload.Username, d.Envelope, event, func() ([]gamelogic.WorldDelta, error) {
+			return game.world.Spawn(d.Payload)
+		})
+		return pubsub.Ack
+	}
+}
+
+func HandlerMove(game *Game) pubsub.Handler[gamelogic.ArmyMove] {
+	return func(d pubsub.Delivery[gamelogic.ArmyMove]) pubsub.AckType {
+		event := gamelogic.Event{Kind: gamelogic.EventMove, Move: &d.Payload}
+		game.order(d.Context(), d.Payload.Player.Username, d.Envelope, event, func() ([]gamelogic.WorldDelta, error) {
+			return game.world.Move(d.Payload)
+		})
+		return pubsub.Ack
+	}
+}
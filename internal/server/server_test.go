@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/topology"
+)
+
+const receiveTimeout = 2 * time.Second
+
+// startGame runs a Game on b, subscribed to orders and serving snapshots as
+// cmd/server does.
+func startGame(t *testing.T, ctx context.Context, b pubsub.Broker, logger *slog.Logger) *Game {
+	t.Helper()
+	if err := topology.Server().Declare(b); err != nil {
+		t.Fatal(err)
+	}
+	game := NewGame(
+		gamelogic.NewWorld(gamelogic.DefaultRules(), gamelogic.ClassicMap(), logger),
+		Config{Publisher: b},
+	)
+	subs := []*pubsub.Subscription{}
+	sub, err := routing.Subscribe(ctx, b, gamelogic.ArmySpawnsRoute, routing.ArmySpawnsPrefix, pubsub.SimpleQueueDurable, HandlerSpawn(game))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subs = append(subs, sub)
+	sub, err = routing.Subscribe(ctx, b, gamelogic.ArmyMovesRoute, routing.ArmyMovesPrefix, pubsub.SimpleQueueDurable, HandlerMove(game))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subs = append(subs, sub)
+	sub, err = routing.Serve(ctx, b, gamelogic.WorldSnapshotRoute, routing.WorldSnapshotKey, pubsub.SimpleQueueDurable, HandlerWorldSnapshot(game))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subs = append(subs, sub)
+	t.Cleanup(func() {
+		for _, sub := range subs {
+			sub.Close()
+		}
+	})
+	return game
+}
+
+// testClient is a player: it sends orders and mirrors the world from the
+// deltas and snapshots the server publishes, as cmd/client does.
+type testClient struct {
+	gs     *gamelogic.GameState
+	mirror *gamelogic.Mirror
+	ctx    context.Context
+	b      pubsub.Broker
+}
+
+func startTestClient(t *testing.T, ctx context.Context, b pubsub.Broker, logger *slog.Logger, username string) *testClient {
+	t.Helper()
+	if err := topology.Client(username).Declare(b); err != nil {
+		t.Fatal(err)
+	}
+	gs := gamelogic.NewGameState(
+		username,
+		gamelogic.WithLogger(logger),
+		gamelogic.WithPresenter(gamelogic.NewPresenter(io.Discard)),
+	)
+	mirror := gamelogic.NewMirror(gs, func(ctx context.Context) (gamelogic.WorldSnapshot, error) {
+		return routing.Request[gamelogic.WorldSnapshotRequest, gamelogic.WorldSnapshot](ctx, b, gamelogic.WorldSnapshotRoute, nil, gamelogic.WorldSnapshotRequest{})
+	})
+	sub, err := routing.Subscribe(ctx, b, gamelogic.WorldDeltasRoute, topology.WorldDeltasQueue(username), pubsub.SimpleQueueTransient,
+		func(d pubsub.Delivery[gamelogic.WorldDelta]) pubsub.AckType {
+			return mirror.HandleDelta(d.Context(), d.Payload)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sub.Close() })
+	syncCtx, cancel := context.WithTimeout(ctx, receiveTimeout)
+	defer cancel()
+	if err := mirror.Sync(syncCtx); err != nil {
+		t.Fatal(err)
+	}
+	return &testClient{gs: gs, mirror: mirror, ctx: pubsub.ContextWithSender(ctx, username), b: b}
+}
+
+// command runs a spawn or move command and waits for the server's answer.
+func (c *testClient) command(t *testing.T, line string) {
+	t.Helper()
+	words := strings.Fields(line)
+	c.gs.ExpectAnswer()
+	var err error
+	params := routing.Params{"username": c.gs.GetUsername()}
+	switch words[0] {
+	case "spawn":
+		var spawn gamelogic.ArmySpawn
+		spawn, err = c.gs.CommandSpawn(words)
+		if err == nil {
+			err = routing.Publish(c.ctx, c.b, gamelogic.ArmySpawnsRoute, params, spawn)
+		}
+	case "move":
+		var move gamelogic.ArmyMove
+		move, err = c.gs.CommandMove(words)
+		if err == nil {
+			err = routing.Publish(c.ctx, c.b, gamelogic.ArmyMovesRoute, params, move)
+		}
+	}
+	if err != nil {
+		t.Fatalf("%s: %v", line, err)
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, receiveTimeout)
+	defer cancel()
+	if err := c.gs.AwaitAnswer(ctx); err != nil {
+		t.Fatalf("%s: %v", line, err)
+	}
+}
+
+// waitForSeq waits until the client has applied every delta up to seq.
+func (c *testClient) waitForSeq(t *testing.T, seq uint64) {
+	t.Helper()
+	deadline := time.Now().Add(receiveTimeout)
+	for time.Now().Before(deadline) {
+		if got, synced := c.mirror.Seq(); synced && got >= seq {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	got, _ := c.mirror.Seq()
+	t.Fatalf("%s is at delta %d, want %d", c.gs.GetUsername(), got, seq)
+}
+
+func TestGame(t *testing.T) {
+	b := pubsub.NewMemoryBroker()
+	defer b.Close()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx, cancel := context.WithCancel(pubsub.ContextWithLogger(context.Background(), logger))
+	defer cancel()
+
+	game := startGame(t, ctx, b, logger)
+	alice := startTestClient(t, ctx, b, logger, "alice")
+	bob := startTestClient(t, ctx, b, logger, "bob")
+
+	alice.command(t, "spawn ukraine infantry")
+	bob.command(t, "spawn ural artillery")
+	bob.command(t, "move ukraine 1")
+
+	snapshot := game.Snapshot()
+	alice.waitForSeq(t, snapshot.Seq)
+	bob.waitForSeq(t, snapshot.Seq)
+
+	if units := alice.gs.GetPlayerSnap().Units; len(units) != 0 {
+		t.Errorf("alice still has %v after losing the war", units)
+	}
+	unit, ok := bob.gs.GetUnit(1)
+	if !ok || unit.Location != "ukraine" {
+		t.Errorf("bob's unit 1 = %v, %v; want it in ukraine", unit, ok)
+	}
+	want := snapshot.Players
+	for _, c := range []*testClient{alice, bob} {
+		got := c.mirror.Players()
+		if len(got) != len(want) {
+			t.Fatalf("%s sees %d players, want %d", c.gs.GetUsername(), len(got), len(want))
+		}
+		for i := range want {
+			if got[i].Username != want[i].Username || len(got[i].Units) != len(want[i].Units) {
+				t.Errorf("%s sees %v, want %v", c.gs.GetUsername(), got[i], want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Package topology describes every exchange, queue and binding Peril uses, so
+// a fresh broker can be set up from code instead of by hand.
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gopkg.in/yaml.v3"
+)
+
+const DeadLetterQueue = "peril_dlq"
+
+type Topology struct {
+	Exchanges []Exchange `json:"exchanges" yaml:"exchanges"`
+	Queues    []Queue    `json:"queues" yaml:"queues"`
+}
+
+type Exchange struct {
+	Name string `json:"name" yaml:"name"`
+	Kind string `json:"kind" yaml:"kind"`
+}
+
+type Queue struct {
+	Name string                 `json:"name" yaml:"name"`
+	Type pubsub.SimpleQueueType `json:"type" yaml:"type"`
+	// DeadLetter makes the queue dead-letter to pubsub.DeadLetterExchange,
+	// like every queue declared through pubsub.DeclareAndBind.
+	DeadLetter bool      `json:"dead_letter" yaml:"dead_letter"`
+	Bindings   []Binding `json:"bindings" yaml:"bindings"`
+}
+
+type Binding struct {
+	Exchange string `json:"exchange" yaml:"exchange"`
+	Key      string `json:"key" yaml:"key"`
+}
+
+func PauseQueue(username string) string {
+	return fmt.Sprintf("%s.%s", routing.PauseKey, username)
+}
+
+func WorldDeltasQueue(username string) string {
+	return fmt.Sprintf("%s.%s", routing.WorldDeltasPrefix, username)
+}
+
+func WorldSnapshotsQueue(username string) string {
+	return fmt.Sprintf("%s.%s", routing.WorldSnapshotsPrefix, username)
+}
+
+func exchanges() []Exchange {
+	return []Exchange{
+		{Name: routing.ExchangePerilDirect, Kind: amqp.ExchangeDirect},
+		{Name: routing.ExchangePerilTopic, Kind: amqp.ExchangeTopic},
+		{Name: pubsub.DeadLetterExchange, Kind: amqp.ExchangeFanout},
+	}
+}
+
+func deadLetterQueue() Queue {
+	return Queue{
+		Name: DeadLetterQueue,
+		Type: pubsub.SimpleQueueDurable,
+		Bindings: []Binding{
+			{Exchange: pubsub.DeadLetterExchange, Key: ""},
+		},
+	}
+}
+
+// Server is the topology the server needs.
+func Server() Topology {
+	return Topology{
+		Exchanges: exchanges(),
+		Queues: []Queue{
+			deadLetterQueue(),
+			{
+				Name:       routing.GameLogSlug,
+				Type:       pubsub.SimpleQueueDurable,
+				DeadLetter: true,
+				Bindings: []Binding{
+					{Exchange: routing.GameLogRoute.Exchange, Key: routing.GameLogRoute.Binding()},
+				},
+			},
+			{
+				Name:       routing.ArmySpawnsPrefix,
+				Type:       pubsub.SimpleQueueDurable,
+				DeadLetter: true,
+				Bindings: []Binding{
+					{Exchange: gamelogic.ArmySpawnsRoute.Exchange, Key: gamelogic.ArmySpawnsRoute.Binding()},
+				},
+			},
+			{
+				Name:       routing.ArmyMovesPrefix,
+				Type:       pubsub.SimpleQueueDurable,
+				DeadLetter: true,
+				Bindings: []Binding{
+					{Exchange: gamelogic.ArmyMovesRoute.Exchange, Key: gamelogic.ArmyMovesRoute.Binding()},
+				},
+			},
+			{
+				Name:       routing.WorldSnapshotKey,
+				Type:       pubsub.SimpleQueueDurable,
+				DeadLetter: true,
+				Bindings: []Binding{
+					{Exchange: gamelogic.WorldSnapshotRoute.Exchange, Key: gamelogic.WorldSnapshotRoute.Binding()},
+				},
+			},
+		},
+	}
+}
+
+// Client is the topology a client playing as username needs.
+func Client(username string) Topology {
+	return Topology{
+		Exchanges: exchanges(),
+		Queues: []Queue{
+			deadLetterQueue(),
+			{
+				Name:       PauseQueue(username),
+				Type:       pubsub.SimpleQueueTransient,
+				DeadLetter: true,
+				Bindings: []Binding{
+					{Exchange: routing.PauseRoute.Exchange, Key: routing.PauseRoute.Binding()},
+				},
+			},
+			{
+				Name:       WorldDeltasQueue(username),
+				Type:       pubsub.SimpleQueueTransient,
+				DeadLetter: true,
+				Bindings: []Binding{
+					{Exchange: gamelogic.WorldDeltasRoute.Exchange, Key: gamelogic.WorldDeltasRoute.Binding()},
+				},
+			},
+			{
+				Name:       WorldSnapshotsQueue(username),
+				Type:       pubsub.SimpleQueueTransient,
+				DeadLetter: true,
+				Bindings: []Binding{
+					{Exchange: gamelogic.WorldSnapshotsRoute.Exchange, Key: gamelogic.WorldSnapshotsRoute.Binding()},
+				},
+			},
+		},
+	}
+}
+
+// Rename returns t with its exchanges renamed as pubsub.RenameExchanges would.
+func (t Topology) Rename(names map[string]string) Topology {
+	rename := func(exchange string) string {
+		if name, ok := names[exchange]; ok && name != "" {
+			return name
+		}
+		return exchange
+	}
+	renamed := Topology{}
+	for _, ex := range t.Exchanges {
+		ex.Name = rename(ex.Name)
+		renamed.Exchanges = append(renamed.Exchanges, ex)
+	}
+	for _, q := range t.Queues {
+		bindings := make([]Binding, 0, len(q.Bindings))
+		for _, binding := range q.Bindings {
+			binding.Exchange = rename(binding.Exchange)
+			bindings = append(bindings, binding)
+		}
+		q.Bindings = bindings
+		renamed.Queues = append(renamed.Queues, q)
+	}
+	return renamed
+}
+
+// Declare creates everything in t. Declarations are idempotent, so it is safe
+// to call on every start-up and from every process.
+func (t Topology) Declare(b pubsub.Broker) error {
+	for _, ex := range t.Exchanges {
+		err := b.DeclareExchange(ex.Name, ex.Kind)
+		if err != nil {
+			return fmt.Errorf("could not declare exchange %s: %v", ex.Name, err)
+		}
+	}
+	for _, q := range t.Queues {
+		var args amqp.Table
+		if q.DeadLetter {
+			args = pubsub.QueueArgs()
+		}
+		_, err := b.DeclareQueue(q.Name, q.Type, args)
+		if err != nil {
+			return fmt.Errorf("could not declare queue %s: %v", q.Name, err)
+		}
+		for _, binding := range q.Bindings {
+			err := b.BindQueue(q.Name, binding.Exchange, binding.Key)
+			if err != nil {
+				return fmt.Errorf("could not bind queue %s to %s: %v", q.Name, binding.Exchange, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Export writes t to w as "json" or "yaml".
+func (t Topology) Export(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(t)
+	case "yaml":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		defer encoder.Close()
+		return encoder.Encode(t)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
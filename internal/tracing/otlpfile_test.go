@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestOTLPFileExporter(t *testing.T) {
+	traceID := trace.TraceID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+	parent := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: trace.SpanID{1, 1, 1, 1, 1, 1, 1, 1}})
+	child := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: trace.SpanID{2, 2, 2, 2, 2, 2, 2, 2}})
+	res := resource.NewSchemaless(attribute.String("service.name", "peril-server"))
+	start := time.Unix(1700000000, 5)
+	stubs := tracetest.SpanStubs{
+		{
+			Name:        "consume army_moves",
+			SpanContext: child,
+			Parent:      parent,
+			SpanKind:    trace.SpanKindConsumer,
+			StartTime:   start,
+			EndTime:     start.Add(time.Millisecond),
+			Attributes: []attribute.KeyValue{
+				attribute.Int("messaging.batch.message_count", 3),
+				attribute.Bool("peril.redelivered", true),
+				attribute.StringSlice("peril.units", []string{"1", "2"}),
+			},
+			Status:               sdktrace.Status{Code: codes.Error, Description: "boom"},
+			Resource:             res,
+			InstrumentationScope: instrumentation.Scope{Name: "peril/pubsub"},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := newOTLPFileExporter(&buf).ExportSpans(context.Background(), stubs.Snapshots())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want one export request", len(lines))
+	}
+
+	var got struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []map[string]any
+			}
+			ScopeSpans []struct {
+				Scope struct{ Name string }
+				Spans []map[string]any
+			}
+		}
+	}
+	if err := json.Unmarshal(lines[0], &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("got %s", lines[0])
+	}
+	scope := got.ResourceSpans[0].ScopeSpans[0]
+	if scope.Scope.Name != "peril/pubsub" || len(scope.Spans) != 1 {
+		t.Fatalf("got %s", lines[0])
+	}
+	span := scope.Spans[0]
+	want := map[string]any{
+		"traceId":           "0102030405060708090a0b0c0d0e0f10",
+		"spanId":            "0202020202020202",
+		"parentSpanId":      "0101010101010101",
+		"name":              "consume army_moves",
+		"kind":              float64(5),
+		"startTimeUnixNano": "1700000000000000005",
+		"endTimeUnixNano":   "1700000000001000005",
+	}
+	for key, value := range want {
+		if span[key] != value {
+			t.Errorf("%s = %v, want %v", key, span[key], value)
+		}
+	}
+	status, _ := json.Marshal(span["status"])
+	if string(status) != `{"code":2,"message":"boom"}` {
+		t.Errorf("status = %s", status)
+	}
+	attrs, _ := json.Marshal(span["attributes"])
+	wantAttrs := `[{"key":"messaging.batch.message_count","value":{"intValue":"3"}},` +
+		`{"key":"peril.redelivered","value":{"boolValue":true}},` +
+		`{"key":"peril.units","value":{"arrayValue":{"values":[{"stringValue":"1"},{"stringValue":"2"}]}}}]`
+	if string(attrs) != wantAttrs {
+		t.Errorf("attributes = %s\nwant %s", attrs, wantAttrs)
+	}
+	resAttrs, _ := json.Marshal(got.ResourceSpans[0].Resource.Attributes)
+	if string(resAttrs) != `[{"key":"service.name","value":{"stringValue":"peril-server"}}]` {
+		t.Errorf("resource attributes = %s", resAttrs)
+	}
+}
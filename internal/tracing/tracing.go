@@ -0,0 +1,62 @@
+// Package tracing installs the OpenTelemetry tracer provider the Peril
+// commands export their spans with.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Setup exports the spans of service to exporter: "stdout" to print them
+// for reading, on stderr so they don't interleave with the game, or "file"
+// to append them to path in the OTLP JSON encoding, one export request per
+// line, which OTLP tooling such as the OpenTelemetry Collector can ingest. With an empty exporter nothing is exported, though
+// trace context is still passed along with every message. The returned
+// shutdown flushes any spans not yet written.
+func Setup(service, exporter, path string) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var exp sdktrace.SpanExporter
+	var file *os.File
+	switch exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+		if err != nil {
+			return nil, err
+		}
+	case "file":
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("could not open trace file: %v", err)
+		}
+		exp = newOTLPFileExporter(file)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(service),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}, nil
+}
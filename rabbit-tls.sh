@@ -0,0 +1,48 @@
+#!/bin/bash
+
+# Runs RabbitMQ with TLS on 5671, using a throwaway CA in tls/certs. The
+# client certificate's common name is "guest", so it can log in with
+# -broker-auth external.
+
+certs=tls/certs
+
+case "$1" in
+    certs)
+        echo "Generating certificates in $certs..."
+        mkdir -p "$certs"
+        openssl req -x509 -newkey rsa:2048 -nodes -days 365 -subj "/CN=peril-ca" \
+            -keyout "$certs/ca-key.pem" -out "$certs/ca.pem"
+        for name in server client; do
+            if [ "$name" = server ]; then cn=localhost; else cn=guest; fi
+            openssl req -newkey rsa:2048 -nodes -subj "/CN=$cn" \
+                -keyout "$certs/$name-key.pem" -out "$certs/$name.csr"
+            printf "subjectAltName=DNS:localhost,IP:127.0.0.1\n" > "$certs/$name.ext"
+            openssl x509 -req -days 365 -in "$certs/$name.csr" -extfile "$certs/$name.ext" \
+                -CA "$certs/ca.pem" -CAkey "$certs/ca-key.pem" -CAcreateserial -out "$certs/$name.pem"
+            rm "$certs/$name.csr" "$certs/$name.ext"
+        done
+        chmod 644 "$certs"/*.pem
+        ;;
+    start)
+        if [ ! -f "$certs/ca.pem" ]; then
+            "$0" certs || exit 1
+        fi
+        echo "Starting RabbitMQ container with TLS..."
+        docker run -d --rm --name rabbitmq-tls -p 5671:5671 -p 15672:15672 \
+            -v "$PWD/tls/rabbitmq.conf:/etc/rabbitmq/rabbitmq.conf:ro" \
+            -v "$PWD/tls/enabled_plugins:/etc/rabbitmq/enabled_plugins:ro" \
+            -v "$PWD/$certs:/etc/rabbitmq/certs:ro" \
+            rabbitmq:3.13-management
+        ;;
+    stop)
+        echo "Stopping RabbitMQ container..."
+        docker stop rabbitmq-tls
+        ;;
+    logs)
+        echo "Fetching logs for RabbitMQ container..."
+        docker logs -f rabbitmq-tls
+        ;;
+    *)
+        echo "Usage: $0 {certs|start|stop|logs}"
+        exit 1
+esac